@@ -0,0 +1,75 @@
+// Command ormgen generates orm tagged Go structs from the information_schema of a MySQL database.
+//
+//	ormgen -host 127.0.0.1 -user root -password 123456 -db icity -tables cust_customer,token -pkg models -out ./models
+//
+// With -out every table is written to <out>/<table>.go, otherwise all tables go to stdout.
+// The output only depends on the schema, rerun it and diff to see what changed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"github.com/yanzongzhen/DBOperation/orm"
+	"github.com/yanzongzhen/Logger/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "mysql host")
+	port := flag.Int("port", 3306, "mysql port")
+	user := flag.String("user", "root", "mysql user")
+	password := flag.String("password", "", "mysql password")
+	dbName := flag.String("db", "", "database to read")
+	tables := flag.String("tables", "", "comma separated tables, all tables when empty")
+	pkg := flag.String("pkg", "models", "package name of the generated code")
+	out := flag.String("out", "", "output directory, stdout when empty")
+	null := flag.String("null", orm.NullPointer, "nullable columns as "+orm.NullPointer+" (*T) or "+orm.NullSQL+" (sql.Null*)")
+	flag.Parse()
+
+	logger.InitLogConfig(logger.ERROR, true)
+	if *dbName == "" {
+		fail(fmt.Errorf("-db is required"))
+	}
+	names := make([]string, 0)
+	for _, t := range strings.Split(*tables, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			names = append(names, t)
+		}
+	}
+
+	config := mysql.NewMySqlConfig(*user, *password, *host, *port, *dbName)
+	schema, err := orm.LoadSchema(config, names...)
+	if err != nil {
+		fail(err)
+	}
+	opts := orm.GenerateOptions{Package: *pkg, NullStyle: *null}
+
+	if *out == "" {
+		if err := orm.GenerateStructs(os.Stdout, schema, opts); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fail(err)
+	}
+	for _, t := range schema {
+		buf := &bytes.Buffer{}
+		if err := orm.GenerateStructs(buf, []*orm.TableSchema{t}, opts); err != nil {
+			fail(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(*out, t.Name+".go"), buf.Bytes(), 0644); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "ormgen:", err)
+	os.Exit(1)
+}
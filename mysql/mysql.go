@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -181,6 +182,21 @@ func Query(sqlConfig *DBConfig, sqlSentence string, parser RowsParser, args ...i
 
 }
 
+// QueryRows runs sqlSentence with ctx and returns the rows, the caller must close them
+func QueryRows(ctx context.Context, sqlConfig *DBConfig, sqlSentence string, args ...interface{}) (*sql.Rows, error) {
+	logger.Debugf("sqlsentence:%s args:%v", sqlSentence, args)
+	var rows *sql.Rows
+	err := dealMySql(sqlConfig, func(db *sql.DB) error {
+		var err error
+		rows, err = db.QueryContext(ctx, sqlSentence, args...)
+		if err != nil {
+			logger.Debugln(err)
+		}
+		return err
+	}, 1)
+	return rows, err
+}
+
 func Insert(sqlConfig *DBConfig, sqlSentence string, parser ResultParser, args ...interface{}) error {
 	logger.Debugf("sqlsentence:%s args:%v\n", sqlSentence, args)
 	return dealMySql(sqlConfig, func(db *sql.DB) error {
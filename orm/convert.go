@@ -0,0 +1,112 @@
+package orm
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Converter turns the raw column bytes into a value assignable or convertible to the registered type.
+// The bytes are only valid during the call.
+type Converter func(data []byte) (interface{}, error)
+
+var (
+	converters   = make(map[reflect.Type]Converter)
+	convertersMu sync.RWMutex
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func init() {
+	RegisterConverter(reflect.TypeOf(time.Duration(0)), parseDuration)
+}
+
+// RegisterConverter makes orm decode columns into fields of type t with c, e.g. for third party decimal or uuid types.
+// Call it at startup, a registered converter wins over sql.Scanner and encoding.TextUnmarshaler.
+func RegisterConverter(t reflect.Type, c Converter) {
+	convertersMu.Lock()
+	if c == nil {
+		delete(converters, t)
+	} else {
+		converters[t] = c
+	}
+	convertersMu.Unlock()
+	// cached plans hold the decoders picked before
+	planCache.Range(func(key, value interface{}) bool {
+		planCache.Delete(key)
+		return true
+	})
+}
+
+func lookupConverter(t reflect.Type) (Converter, bool) {
+	convertersMu.RLock()
+	c, ok := converters[t]
+	convertersMu.RUnlock()
+	return c, ok
+}
+
+func asBytes(src interface{}) []byte {
+	switch s := src.(type) {
+	case []byte:
+		return s
+	case string:
+		return []byte(s)
+	}
+	return []byte(asString(src))
+}
+
+func newConverterDecoder(t reflect.Type, c Converter) fieldDecoder {
+	return func(dst reflect.Value, src interface{}) error {
+		value, err := c(asBytes(src))
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(value)
+		switch {
+		case !rv.IsValid():
+			dst.Set(reflect.Zero(t))
+		case rv.Type().AssignableTo(t):
+			dst.Set(rv)
+		case rv.Type().ConvertibleTo(t):
+			dst.Set(rv.Convert(t))
+		default:
+			return errors.New("converter of " + t.String() + " returned " + rv.Type().String())
+		}
+		return nil
+	}
+}
+
+func decodeText(dst reflect.Value, src interface{}) error {
+	return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(asBytes(src))
+}
+
+// parseDuration accepts nanoseconds, Go duration strings ("1h30m") and MySQL TIME values ("-838:59:59.000000")
+func parseDuration(data []byte) (interface{}, error) {
+	s := string(data)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(n), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, errors.New("can't parse " + string(data) + " to time.Duration")
+	}
+	h, err1 := strconv.ParseInt(parts[0], 10, 64)
+	m, err2 := strconv.ParseInt(parts[1], 10, 64)
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, errors.New("can't parse " + string(data) + " to time.Duration")
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second))
+	return sign * d, nil
+}
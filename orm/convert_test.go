@@ -0,0 +1,63 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+type upper string
+
+func (u *upper) Scan(src interface{}) error {
+	*u = upper(strings.ToUpper(asString(src)))
+	return nil
+}
+
+type money struct {
+	cents int64
+}
+
+type custom struct {
+	Level    level         `orm:"level"`
+	Code     upper         `orm:"code"`
+	Duration time.Duration `orm:"duration"`
+	Wait     time.Duration `orm:"wait"`
+	Price    *money        `orm:"price"`
+}
+
+func TestScanRowsCustomTypes(t *testing.T) {
+	RegisterConverter(reflect.TypeOf(money{}), func(data []byte) (interface{}, error) {
+		n, err := strconv.ParseInt(string(data), 10, 64)
+		return money{cents: n}, err
+	})
+	defer RegisterConverter(reflect.TypeOf(money{}), nil)
+
+	columns := []string{"level", "code", "duration", "wait", "price"}
+	types := []string{"VARCHAR", "VARCHAR", "TIME", "BIGINT", "DECIMAL"}
+	res := custom{}
+	err := fakeScan(t, &res, columns, types, []driver.Value{[]byte("high"), []byte("ab"), []byte("01:30:00"), int64(time.Second), []byte("1999")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Level != 2 || res.Code != "AB" || res.Duration != 90*time.Minute || res.Wait != time.Second || res.Price == nil || res.Price.cents != 1999 {
+		t.Fatal(res)
+	}
+}
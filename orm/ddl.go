@@ -0,0 +1,394 @@
+package orm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	sqlTypes       = map[reflect.Type]string{
+		reflect.TypeOf(sql.NullString{}):  "varchar(255)",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullFloat64{}): "double",
+		reflect.TypeOf(sql.NullBool{}):    "tinyint(1)",
+		reflect.TypeOf(sql.NullTime{}):    "datetime",
+		timeType:                          "datetime",
+		durationType:                      "time",
+		rawMessageType:                    "json",
+	}
+)
+
+// ddlTag is the parsed ddl tag of a field, entries are separated by ";" like valid tags.
+// comment takes the rest of the tag, ";" included, so it goes last:
+//
+//	ddl:"type=decimal(10,2);null;default=0;index=idx_user_time;unique;comment=price in yuan"
+type ddlTag struct {
+	typ      string
+	size     int
+	null     *bool
+	def      *string
+	index    string
+	unique   string
+	comment  string
+	hasIndex bool
+	isUnique bool
+}
+
+func parseDDLTag(tag string) (*ddlTag, error) {
+	d := &ddlTag{}
+	entries := strings.Split(tag, ";")
+	for i, text := range entries {
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "comment=") {
+			d.comment = strings.TrimSpace(strings.Join(append([]string{text}, entries[i+1:]...), ";")[len("comment="):])
+			break
+		}
+		if text == "" {
+			continue
+		}
+		name, param := text, ""
+		if i := strings.Index(text, "="); i != -1 {
+			name, param = text[:i], text[i+1:]
+		}
+		switch name {
+		case "type":
+			d.typ = param
+		case "size":
+			n, err := strconv.Atoi(param)
+			if err != nil || n <= 0 {
+				return nil, errors.New("bad " + text)
+			}
+			d.size = n
+		case "null", "notnull":
+			null := name == "null"
+			d.null = &null
+		case "default":
+			def := param
+			d.def = &def
+		case "index":
+			d.hasIndex, d.index = true, param
+		case "unique":
+			d.isUnique, d.unique = true, param
+		default:
+			return nil, errors.New("unknown ddl option " + name)
+		}
+	}
+	return d, nil
+}
+
+// sqlType returns the column type of a field of type t and whether it is nullable by default
+func sqlType(f *field, size int) (string, bool, error) {
+	t := f.typ
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	if f.json && f.encrypt {
+		// the ciphertext is not valid JSON
+		return "text", true, nil
+	}
+	if f.json {
+		return "json", true, nil
+	}
+	if s, ok := sqlTypes[t]; ok {
+		if t.Kind() == reflect.Struct && t != timeType {
+			// sql.Null* types
+			nullable = true
+		}
+		if size > 0 && strings.HasPrefix(s, "varchar") {
+			s = "varchar(" + strconv.Itoa(size) + ")"
+		}
+		return s, nullable, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "tinyint(1)", nullable, nil
+	case reflect.Int8:
+		return "tinyint", nullable, nil
+	case reflect.Int16:
+		return "smallint", nullable, nil
+	case reflect.Int, reflect.Int32:
+		return "int", nullable, nil
+	case reflect.Int64:
+		return "bigint", nullable, nil
+	case reflect.Uint8:
+		return "tinyint unsigned", nullable, nil
+	case reflect.Uint16:
+		return "smallint unsigned", nullable, nil
+	case reflect.Uint, reflect.Uint32:
+		return "int unsigned", nullable, nil
+	case reflect.Uint64:
+		return "bigint unsigned", nullable, nil
+	case reflect.Float32:
+		return "float", nullable, nil
+	case reflect.Float64:
+		return "double", nullable, nil
+	case reflect.String:
+		if size == 0 {
+			size = 255
+		}
+		return "varchar(" + strconv.Itoa(size) + ")", nullable, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if size > 0 {
+				return "varbinary(" + strconv.Itoa(size) + ")", true, nil
+			}
+			return "blob", true, nil
+		}
+	}
+	return "", false, errors.New("un support type:" + f.typ.String() + ", set it with ddl:\"type=...\"")
+}
+
+// StructSchema describes the table the struct pointed by ptr maps to, as CreateTable and DiffTable see it.
+// Column types come from the Go types unless set with the ddl tag, pointers and sql.Null* types are nullable.
+func StructSchema(table string, ptr interface{}) (*TableSchema, error) {
+	t := reflect.TypeOf(ptr)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("v must be pointer to struct")
+	}
+	ts := &TableSchema{Name: table}
+	pk := &IndexSchema{Name: "PRIMARY", Unique: true}
+	indexes := make(map[string]*IndexSchema)
+	for _, f := range typeFields(t) {
+		d, err := parseDDLTag(f.tag.Get("ddl"))
+		if err != nil {
+			return nil, errors.New(f.fieldName + ": " + err.Error())
+		}
+		typ, nullable, err := sqlType(f, d.size)
+		if d.typ != "" {
+			typ, err = d.typ, nil
+		}
+		if err != nil {
+			return nil, errors.New(f.fieldName + ": " + err.Error())
+		}
+		if d.null != nil {
+			nullable = *d.null
+		}
+		c := &ColumnSchema{
+			Table:      table,
+			Name:       f.name,
+			Position:   len(ts.Columns) + 1,
+			Default:    d.def,
+			Nullable:   nullable && !f.pk,
+			DataType:   strings.ToLower(strings.Fields(strings.Split(typ, "(")[0])[0]),
+			ColumnType: typ,
+			Comment:    d.comment,
+		}
+		if f.pk {
+			c.Key = "PRI"
+			pk.Columns = append(pk.Columns, f.name)
+		}
+		if f.autoIncrement {
+			c.Extra = "auto_increment"
+		}
+		ts.Columns = append(ts.Columns, c)
+
+		add := func(name string, unique bool) {
+			idx, ok := indexes[name]
+			if !ok {
+				idx = &IndexSchema{Name: name, Unique: unique}
+				indexes[name] = idx
+				ts.Indexes = append(ts.Indexes, idx)
+			}
+			idx.Columns = append(idx.Columns, f.name)
+		}
+		if d.hasIndex {
+			if d.index == "" {
+				d.index = "idx_" + f.name
+			}
+			add(d.index, false)
+		}
+		if d.isUnique {
+			if d.unique == "" {
+				d.unique = "uk_" + f.name
+			}
+			add(d.unique, true)
+		}
+		if f.blind != "" {
+			// hex of a truncated HMAC-SHA256, see BlindIndex
+			ts.Columns = append(ts.Columns, &ColumnSchema{Table: table, Name: f.blind, Position: len(ts.Columns) + 1,
+				Nullable: true, DataType: "char", ColumnType: "char(32)"})
+			name := "idx_" + f.blind
+			indexes[name] = &IndexSchema{Name: name, Columns: []string{f.blind}}
+			ts.Indexes = append(ts.Indexes, indexes[name])
+		}
+	}
+	if len(ts.Columns) == 0 {
+		return nil, ErrorNoColumns
+	}
+	if len(pk.Columns) > 0 {
+		ts.Indexes = append([]*IndexSchema{pk}, ts.Indexes...)
+	}
+	return ts, nil
+}
+
+// defaultLiteral quotes a default value unless it is a number, NULL, CURRENT_TIMESTAMP or an expression
+func defaultLiteral(s string) string {
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	upper := strings.ToUpper(s)
+	if upper == "NULL" || strings.HasPrefix(upper, "CURRENT_TIMESTAMP") ||
+		strings.HasPrefix(s, "(") || strings.HasPrefix(s, "'") {
+		return s
+	}
+	return stringLiteral(s)
+}
+
+// stringLiteral returns s as a quoted MySQL string literal
+func stringLiteral(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func columnDefinition(c *ColumnSchema) string {
+	b := &strings.Builder{}
+	b.WriteString(quote(c.Name) + " " + c.ColumnType)
+	if c.Nullable {
+		b.WriteString(" NULL")
+	} else {
+		b.WriteString(" NOT NULL")
+	}
+	if c.Default != nil {
+		b.WriteString(" DEFAULT " + defaultLiteral(*c.Default))
+	}
+	if c.IsAutoIncrement() {
+		b.WriteString(" AUTO_INCREMENT")
+	}
+	if c.Comment != "" {
+		b.WriteString(" COMMENT " + stringLiteral(c.Comment))
+	}
+	return b.String()
+}
+
+func indexDefinition(idx *IndexSchema) string {
+	cols := make([]string, len(idx.Columns))
+	for i, c := range idx.Columns {
+		cols[i] = quote(c)
+	}
+	switch {
+	case idx.Name == "PRIMARY":
+		return "PRIMARY KEY (" + strings.Join(cols, ",") + ")"
+	case idx.Unique:
+		return "UNIQUE KEY " + quote(idx.Name) + " (" + strings.Join(cols, ",") + ")"
+	}
+	return "KEY " + quote(idx.Name) + " (" + strings.Join(cols, ",") + ")"
+}
+
+// CreateTableSQL returns the CREATE TABLE statement of t, without trailing semicolon
+func CreateTableSQL(t *TableSchema) string {
+	lines := make([]string, 0, len(t.Columns)+len(t.Indexes))
+	for _, c := range t.Columns {
+		lines = append(lines, "  "+columnDefinition(c))
+	}
+	for _, idx := range t.Indexes {
+		lines = append(lines, "  "+indexDefinition(idx))
+	}
+	s := "CREATE TABLE " + quote(t.Name) + " (\n" + strings.Join(lines, ",\n") + "\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if t.Comment != "" {
+		s += " COMMENT=" + stringLiteral(t.Comment)
+	}
+	return s
+}
+
+// CreateTable returns the CREATE TABLE statement of the table the struct pointed by ptr maps to
+//
+//	s, err := orm.CreateTable("token", &Token{})
+//	err = mysql.ExecSql(config, s)
+func CreateTable(table string, ptr interface{}) (string, error) {
+	t, err := StructSchema(table, ptr)
+	if err != nil {
+		return "", err
+	}
+	return CreateTableSQL(t), nil
+}
+
+func sameIndex(a, b *IndexSchema) bool {
+	if a.Unique != b.Unique || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if !strings.EqualFold(a.Columns[i], b.Columns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffSchema returns the ALTER statements adding to have the columns and indexes of want it misses.
+// Indexes are matched by columns and uniqueness, not name. Nothing is ever dropped or modified,
+// extra columns and indexes of have are left alone. A nil have gives the CREATE TABLE of want.
+func DiffSchema(want, have *TableSchema) []string {
+	if have == nil {
+		return []string{CreateTableSQL(want)}
+	}
+	stmts := make([]string, 0)
+	existing := make(map[string]bool, len(have.Columns))
+	for _, c := range have.Columns {
+		existing[strings.ToLower(c.Name)] = true
+	}
+	prev := ""
+	for _, c := range want.Columns {
+		if !existing[strings.ToLower(c.Name)] {
+			pos := " FIRST"
+			if prev != "" {
+				pos = " AFTER " + quote(prev)
+			}
+			stmts = append(stmts, "ALTER TABLE "+quote(want.Name)+" ADD COLUMN "+columnDefinition(c)+pos)
+		}
+		prev = c.Name
+	}
+	for _, idx := range want.Indexes {
+		found := false
+		for _, h := range have.Indexes {
+			if sameIndex(idx, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			stmts = append(stmts, "ALTER TABLE "+quote(want.Name)+" ADD "+indexDefinition(idx))
+		}
+	}
+	return stmts
+}
+
+// DiffTable compares the struct pointed by ptr with the live schema of table and returns the statements
+// bringing the table up to date, each one can be run with mysql.ExecSql or saved with WriteMigration.
+func DiffTable(db *mysql.DBConfig, table string, ptr interface{}) ([]string, error) {
+	want, err := StructSchema(table, ptr)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := LoadSchema(db, table)
+	if err != nil && err != mysql.ErrorNotFound {
+		return nil, err
+	}
+	var have *TableSchema
+	if len(tables) > 0 {
+		have = tables[0]
+	}
+	return DiffSchema(want, have), nil
+}
+
+// WriteMigration writes stmts as a migration file, one statement per line ended by a semicolon
+func WriteMigration(w io.Writer, stmts []string) error {
+	for _, s := range stmts {
+		if _, err := io.WriteString(w, s+";\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
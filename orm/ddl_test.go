@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ddlOrder struct {
+	ID         int64     `orm:"id,pk,autoincrement"`
+	UserID     int64     `orm:"user_id" ddl:"index=idx_user_time"`
+	No         string    `orm:"no" ddl:"size=32;unique;comment=order number"`
+	Price      string    `orm:"price" ddl:"type=decimal(10,2);default=0"`
+	Status     int8      `orm:"status" ddl:"default=1"`
+	Remark     *string   `orm:"remark" ddl:"type=text"`
+	Tags       []string  `orm:"tags,json"`
+	CreateTime time.Time `orm:"create_time" ddl:"index=idx_user_time;default=CURRENT_TIMESTAMP"`
+}
+
+func TestCreateTable(t *testing.T) {
+	s, err := CreateTable("orders", &ddlOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE TABLE `orders` (\n" +
+		"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+		"  `user_id` bigint NOT NULL,\n" +
+		"  `no` varchar(32) NOT NULL COMMENT 'order number',\n" +
+		"  `price` decimal(10,2) NOT NULL DEFAULT 0,\n" +
+		"  `status` tinyint NOT NULL DEFAULT 1,\n" +
+		"  `remark` text NULL,\n" +
+		"  `tags` json NULL,\n" +
+		"  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx_user_time` (`user_id`,`create_time`),\n" +
+		"  UNIQUE KEY `uk_no` (`no`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if s != want {
+		t.Fatalf("got\n%s\nwant\n%s", s, want)
+	}
+
+	type bad struct {
+		Items map[string]int `orm:"items"`
+	}
+	if _, err := CreateTable("bad", &bad{}); err == nil {
+		t.Fatal("expected error for map without type")
+	}
+	type badTag struct {
+		Name string `ddl:"length=3"`
+	}
+	if _, err := CreateTable("bad", &badTag{}); err == nil {
+		t.Fatal("expected error for unknown option")
+	}
+
+	// comments are always string literals and may contain ";"
+	type commented struct {
+		A int    `orm:"a" ddl:"comment=123"`
+		B string `orm:"b" ddl:"size=8;comment=(legacy) name; it's a 'b'\\"`
+	}
+	ts, err := StructSchema("c", &commented{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Comment = "NULL"
+	s = CreateTableSQL(ts)
+	for _, part := range []string{
+		"`a` int NOT NULL COMMENT '123'",
+		"`b` varchar(8) NOT NULL COMMENT '(legacy) name; it''s a ''b''\\\\'",
+		"COMMENT='NULL'",
+	} {
+		if !strings.Contains(s, part) {
+			t.Fatalf("%s\nmissing %s", s, part)
+		}
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	want, err := StructSchema("orders", &ddlOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmts := DiffSchema(want, nil); len(stmts) != 1 || !strings.HasPrefix(stmts[0], "CREATE TABLE") {
+		t.Fatal(stmts)
+	}
+
+	have := &TableSchema{
+		Name: "orders",
+		Columns: []*ColumnSchema{
+			{Name: "id"}, {Name: "USER_ID"}, {Name: "no"}, {Name: "status"}, {Name: "legacy"},
+		},
+		Indexes: []*IndexSchema{
+			{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+			{Name: "no_unique", Unique: true, Columns: []string{"no"}},
+		},
+	}
+	stmts := DiffSchema(want, have)
+	expected := []string{
+		"ALTER TABLE `orders` ADD COLUMN `price` decimal(10,2) NOT NULL DEFAULT 0 AFTER `no`",
+		"ALTER TABLE `orders` ADD COLUMN `remark` text NULL AFTER `status`",
+		"ALTER TABLE `orders` ADD COLUMN `tags` json NULL AFTER `remark`",
+		"ALTER TABLE `orders` ADD COLUMN `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `tags`",
+		"ALTER TABLE `orders` ADD KEY `idx_user_time` (`user_id`,`create_time`)",
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("got %d statements: %q", len(stmts), stmts)
+	}
+	for i := range expected {
+		if stmts[i] != expected[i] {
+			t.Fatalf("statement %d\ngot  %s\nwant %s", i, stmts[i], expected[i])
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteMigration(buf, stmts[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), ";\n") != 2 {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,102 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/yanzongzhen/Logger/logger"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeDriver serves canned result sets registered by query text, it lets the scan path run without a MySQL server
+type fakeDriver struct{}
+
+type fakeResult struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+}
+
+var (
+	fakeResults   = make(map[string]*fakeResult)
+	fakeResultsMu sync.RWMutex
+	fakeSeq       int
+	fakeDB        *sql.DB
+)
+
+func init() {
+	logger.InitLogConfig(logger.ERROR, true)
+	sql.Register("ormfake", fakeDriver{})
+	fakeDB, _ = sql.Open("ormfake", "")
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(query), nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt string
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fakeResultsMu.RLock()
+	r, ok := fakeResults[string(s)]
+	fakeResultsMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown query:" + string(s))
+	}
+	return &fakeRows{result: r}, nil
+}
+
+type fakeRows struct {
+	result *fakeResult
+	pos    int
+}
+
+func (r *fakeRows) Columns() []string { return r.result.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.pos])
+	r.pos++
+	return nil
+}
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string { return r.result.types[index] }
+
+// fakeQuery registers a result set and returns the rows of it
+func fakeQuery(t testing.TB, columns []string, types []string, rows ...[]driver.Value) *sql.Rows {
+	fakeResultsMu.Lock()
+	fakeSeq++
+	query := t.Name() + strconv.Itoa(fakeSeq)
+	fakeResults[query] = &fakeResult{columns: columns, types: types, rows: rows}
+	fakeResultsMu.Unlock()
+	res, err := fakeDB.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// fakeScan scans a canned result set into ptr the same way Query does
+func fakeScan(t testing.TB, ptr interface{}, columns []string, types []string, rows ...[]driver.Value) error {
+	return fakeScanWith(t, ptr, &queryOptions{}, columns, types, rows...)
+}
+
+func fakeScanWith(t testing.TB, ptr interface{}, opts *queryOptions, columns []string, types []string, rows ...[]driver.Value) error {
+	res := fakeQuery(t, columns, types, rows...)
+	defer res.Close()
+	return scanRows(res, reflect.ValueOf(ptr), opts)
+}
@@ -0,0 +1,260 @@
+package orm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorNoKeyProvider   = errors.New("no key provider, call orm.SetKeyProvider")
+	ErrorNoBlindIndexKey = errors.New("no blind index key, call orm.SetBlindIndexKey")
+	ErrorUnknownKey      = errors.New("unknown encryption key id")
+	ErrorNotEncrypted    = errors.New("value is not encrypted")
+)
+
+// KeyProvider supplies the AES keys (16, 24 or 32 bytes) of the columns tagged encrypt.
+// Values are stored as "<key id>:<base64 nonce and ciphertext>", so after a rotation the
+// old rows still decrypt with their key while new writes use the current one.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with and its id, the id must not contain ":"
+	CurrentKey() (string, []byte, error)
+	// Key returns the key of id
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is an in memory KeyProvider
+//
+//	ring, err := orm.NewKeyRing("2020", map[string][]byte{"2020": key2020})
+//	orm.SetKeyProvider(ring)
+//	// later
+//	err = ring.Rotate("2021", key2021)
+type KeyRing struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+func checkKey(id string, key []byte) error {
+	if id == "" || strings.Contains(id, ":") {
+		return errors.New("bad key id:" + id)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return errors.New("key " + id + " must be 16, 24 or 32 bytes")
+}
+
+// NewKeyRing returns a KeyRing encrypting with keys[current]
+func NewKeyRing(current string, keys map[string][]byte) (*KeyRing, error) {
+	r := &KeyRing{keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if err := checkKey(id, key); err != nil {
+			return nil, err
+		}
+		r.keys[id] = key
+	}
+	if _, ok := r.keys[current]; !ok {
+		return nil, ErrorUnknownKey
+	}
+	r.current = current
+	return r, nil
+}
+
+// Rotate adds key as id and encrypts the next writes with it, the previous keys keep decrypting
+func (r *KeyRing) Rotate(id string, key []byte) error {
+	if err := checkKey(id, key); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.keys[id] = key
+	r.current = id
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current, r.keys[r.current], nil
+}
+
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if key, ok := r.keys[id]; ok {
+		return key, nil
+	}
+	return nil, ErrorUnknownKey
+}
+
+var (
+	keyProvider   KeyProvider
+	blindIndexKey []byte
+	encryptMu     sync.RWMutex
+)
+
+// SetKeyProvider sets the keys of the columns tagged encrypt
+func SetKeyProvider(p KeyProvider) {
+	encryptMu.Lock()
+	keyProvider = p
+	encryptMu.Unlock()
+}
+
+// SetBlindIndexKey sets the HMAC key of the blind index columns, it must never change once rows are written
+func SetBlindIndexKey(key []byte) {
+	encryptMu.Lock()
+	blindIndexKey = key
+	encryptMu.Unlock()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts plain with the current key of the key provider, the key id is authenticated too
+func Encrypt(plain []byte) (string, error) {
+	encryptMu.RLock()
+	p := keyProvider
+	encryptMu.RUnlock()
+	if p == nil {
+		return "", ErrorNoKeyProvider
+	}
+	id, key, err := p.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plain)+gcm.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(id))
+	return id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt with the key named by the prefix of s
+func Decrypt(s string) ([]byte, error) {
+	encryptMu.RLock()
+	p := keyProvider
+	encryptMu.RUnlock()
+	if p == nil {
+		return nil, ErrorNoKeyProvider
+	}
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return nil, ErrorNotEncrypted
+	}
+	key, err := p.Key(s[:i])
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(s[i+1:])
+	if err != nil {
+		return nil, ErrorNotEncrypted
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrorNotEncrypted
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(s[:i]))
+}
+
+// BlindIndex returns the deterministic HMAC of value stored in blind index columns, use it for equality lookups:
+//
+//	idx, err := orm.BlindIndex(mobile)
+//	err = orm.Query(config, "select * from cust_customer where mobile_bidx = ?", &res, idx)
+func BlindIndex(value string) (string, error) {
+	encryptMu.RLock()
+	key := blindIndexKey
+	encryptMu.RUnlock()
+	if len(key) == 0 {
+		return "", ErrorNoBlindIndexKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// plainValue returns the text of an encrypted field, false for nil
+func plainValue(f *field, fv reflect.Value) (string, bool, error) {
+	if f.json {
+		// marshaled first, then encrypted like a string
+		arg, err := jsonValue(fv)
+		if err != nil || arg == nil {
+			return "", false, err
+		}
+		return arg.(string), true, nil
+	}
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return "", false, nil
+		}
+		fv = fv.Elem()
+	}
+	switch {
+	case fv.Kind() == reflect.String:
+		return fv.String(), true, nil
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8:
+		if fv.IsNil() {
+			return "", false, nil
+		}
+		return string(fv.Bytes()), true, nil
+	}
+	return "", false, errors.New("encrypt field must be string or []byte:" + f.fieldName)
+}
+
+// encryptedValue returns the argument written for an encrypted field, empty values are stored as is
+func encryptedValue(f *field, fv reflect.Value) (interface{}, error) {
+	s, ok, err := plainValue(f, fv)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if s == "" {
+		return "", nil
+	}
+	return Encrypt([]byte(s))
+}
+
+// blindValue returns the argument written for the blind index column of f
+func blindValue(f *field, fv reflect.Value) (interface{}, error) {
+	s, ok, err := plainValue(f, fv)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return BlindIndex(s)
+}
+
+// decryptDecoder decrypts the column before decoding it into the field
+func decryptDecoder(decode fieldDecoder) fieldDecoder {
+	return func(dst reflect.Value, src interface{}) error {
+		if isEmptySrc(src) {
+			return decode(dst, src)
+		}
+		plain, err := Decrypt(string(asBytes(src)))
+		if err != nil {
+			return err
+		}
+		return decode(dst, plain)
+	}
+}
@@ -0,0 +1,150 @@
+package orm
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type secretCustomer struct {
+	ID     int64   `orm:"id,pk"`
+	Mobile string  `orm:"mobile,encrypt" blind:"mobile_bidx"`
+	IDCard *string `orm:"id_card,encrypt"`
+}
+
+func setTestKeys(t *testing.T) *KeyRing {
+	ring, err := NewKeyRing("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyProvider(ring)
+	SetBlindIndexKey([]byte("blind"))
+	return ring
+}
+
+func TestEncryptRotation(t *testing.T) {
+	ring := setTestKeys(t)
+	defer SetKeyProvider(nil)
+	defer SetBlindIndexKey(nil)
+
+	old, err := Encrypt([]byte("18653558566"))
+	if err != nil || !strings.HasPrefix(old, "k1:") {
+		t.Fatal(old, err)
+	}
+	again, _ := Encrypt([]byte("18653558566"))
+	if again == old {
+		t.Fatal("nonce reused")
+	}
+	if err := ring.Rotate("k2", bytes.Repeat([]byte{2}, 16)); err != nil {
+		t.Fatal(err)
+	}
+	cur, _ := Encrypt([]byte("18653558566"))
+	if !strings.HasPrefix(cur, "k2:") {
+		t.Fatal(cur)
+	}
+	for _, s := range []string{old, cur} {
+		if plain, err := Decrypt(s); err != nil || string(plain) != "18653558566" {
+			t.Fatal(string(plain), err)
+		}
+	}
+	// the key id is authenticated
+	if _, err := Decrypt("k2" + old[2:]); err == nil {
+		t.Fatal("expected error for swapped key id")
+	}
+	if _, err := Decrypt("k9" + old[2:]); err != ErrorUnknownKey {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt("18653558566"); err != ErrorNotEncrypted {
+		t.Fatal(err)
+	}
+	if err := ring.Rotate("bad:id", bytes.Repeat([]byte{2}, 16)); err == nil {
+		t.Fatal("expected bad key id")
+	}
+
+	a, _ := BlindIndex("18653558566")
+	b, _ := BlindIndex("18653558566")
+	if a != b || len(a) != 32 {
+		t.Fatal(a, b)
+	}
+}
+
+func TestEncryptedColumns(t *testing.T) {
+	setTestKeys(t)
+	defer SetKeyProvider(nil)
+	defer SetBlindIndexKey(nil)
+
+	c := &secretCustomer{Mobile: "18653558566"}
+	v := reflect.ValueOf(c).Elem()
+	s, args, err := buildInsert("cust_customer", v, typeFields(v.Type()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "insert into `cust_customer` (`id`,`mobile`,`mobile_bidx`,`id_card`) values (?,?,?,?)" {
+		t.Fatal(s)
+	}
+	bidx, _ := BlindIndex("18653558566")
+	if args[2] != bidx || args[3] != nil || !strings.HasPrefix(args[1].(string), "k1:") {
+		t.Fatal(args)
+	}
+
+	card, _ := Encrypt([]byte("370101199001011234"))
+	res := secretCustomer{}
+	err = fakeScanWith(t, &res, &queryOptions{strict: true}, []string{"id", "mobile", "mobile_bidx", "id_card"},
+		[]string{"BIGINT", "VARCHAR", "CHAR", "VARCHAR"}, []driver.Value{int64(1), args[1], bidx, card})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Mobile != "18653558566" || res.IDCard == nil || *res.IDCard != "370101199001011234" {
+		t.Fatal(res)
+	}
+
+	SetKeyProvider(nil)
+	if _, _, err := buildInsert("cust_customer", v, typeFields(v.Type())); err != ErrorNoKeyProvider {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedJSON(t *testing.T) {
+	setTestKeys(t)
+	defer SetKeyProvider(nil)
+	defer SetBlindIndexKey(nil)
+
+	type address struct {
+		City string `json:"city"`
+	}
+	type secretProfile struct {
+		ID      int64             `orm:"id,pk"`
+		Address *address          `orm:"address,json,encrypt"`
+		Tags    map[string]string `orm:"tags,json,encrypt"`
+		Level   string            `orm:"level,encrypt" default:"basic"`
+	}
+	p := &secretProfile{ID: 1, Address: &address{City: "jinan"}}
+	v := reflect.ValueOf(p).Elem()
+	s, args, err := buildUpdate("profile", v, typeFields(v.Type()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "update `profile` set `address` = ?,`tags` = ?,`level` = ? where `id` = ?" || args[1] != nil || args[2] != "" {
+		t.Fatal(s, args)
+	}
+	if plain, err := Decrypt(args[0].(string)); err != nil || string(plain) != `{"city":"jinan"}` {
+		t.Fatal(string(plain), err)
+	}
+
+	res := secretProfile{}
+	err = fakeScanWith(t, &res, &queryOptions{strict: true}, []string{"id", "address", "tags", "level"},
+		[]string{"BIGINT", "VARCHAR", "VARCHAR", "VARCHAR"}, []driver.Value{int64(1), args[0], nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default is plain text, it is not decrypted
+	if res.Address == nil || res.Address.City != "jinan" || res.Tags != nil || res.Level != "basic" {
+		t.Fatal(res)
+	}
+	ts, err := StructSchema("profile", &secretProfile{})
+	if err != nil || ts.Columns[1].ColumnType != "text" {
+		t.Fatal(ts, err)
+	}
+}
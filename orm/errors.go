@@ -0,0 +1,65 @@
+package orm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FieldError is one column that couldn't be mapped or one broken validation rule.
+// Row is the 0 based row of the result, -1 for unmapped columns and fields found before reading rows
+// and for validation before writes.
+type FieldError struct {
+	Row    int
+	Column string
+	Field  string
+	Value  string
+	// Rule is the broken valid tag rule, e.g. "len=2:20", empty for conversion errors
+	Rule   string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	if e.Row >= 0 {
+		b.WriteString("row " + strconv.Itoa(e.Row) + " ")
+	}
+	if e.Column != "" {
+		b.WriteString("column " + strconv.Quote(e.Column) + " ")
+	}
+	if e.Field != "" {
+		b.WriteString("field " + e.Field + " ")
+	}
+	if (e.Row >= 0 && e.Column != "") || e.Value != "" {
+		b.WriteString("value " + strconv.Quote(e.Value) + " ")
+	}
+	if e.Rule != "" {
+		b.WriteString("rule " + e.Rule + " ")
+	}
+	b.WriteString(e.Reason)
+	return b.String()
+}
+
+// MultiFieldError lists every FieldError of a strict Query or of a validation
+type MultiFieldError struct {
+	Errors []*FieldError
+}
+
+func (e *MultiFieldError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strconv.Itoa(len(e.Errors)) + " field errors: " + strings.Join(msgs, "; ")
+}
+
+func (e *MultiFieldError) add(err *FieldError) {
+	e.Errors = append(e.Errors, err)
+}
+
+// errOrNil returns nil for an empty MultiFieldError so callers can compare with nil
+func (e *MultiFieldError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,54 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+type strictRow struct {
+	ID    int64  `orm:"id"`
+	Age   int    `orm:"age"`
+	Score int    `orm:"score"`
+	Name  string `orm:"name"`
+}
+
+func TestStrictMultiFieldError(t *testing.T) {
+	columns := []string{"id", "age", "score", "name"}
+	types := []string{"BIGINT", "INT", "INT", "VARCHAR"}
+	row := []driver.Value{int64(1), []byte("x"), []byte("9999999999999999999999"), []byte("tom")}
+
+	lenient := strictRow{}
+	if err := fakeScan(t, &lenient, columns, types, row); err != nil {
+		t.Fatal(err)
+	}
+	if lenient.ID != 1 || lenient.Age != 0 || lenient.Name != "tom" {
+		t.Fatal(lenient)
+	}
+
+	res := make([]strictRow, 0)
+	err := fakeScanWith(t, &res, &queryOptions{strict: true}, columns, types, []driver.Value{int64(0), []byte("1"), []byte("2"), nil}, row)
+	multi, ok := err.(*MultiFieldError)
+	if !ok || len(multi.Errors) != 2 {
+		t.Fatal(err)
+	}
+	if e := multi.Errors[0]; e.Row != 1 || e.Column != "age" || e.Field != "Age" || e.Value != "x" {
+		t.Fatal(e)
+	}
+
+	err = fakeScanWith(t, &res, &queryOptions{strict: true}, append(columns[1:], "extra"), append(types[1:], "INT"), row)
+	multi, ok = err.(*MultiFieldError)
+	if !ok || len(multi.Errors) != 2 || multi.Errors[0].Field != "ID" || multi.Errors[1].Column != "extra" {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, opts := splitArgs([]interface{}{1, Strict(), "a"})
+	if len(args) != 2 || args[1] != "a" || !opts.strict {
+		t.Fatal(args, opts)
+	}
+	args, opts = splitArgs([]interface{}{Strict(), Lenient()})
+	if len(args) != 0 || opts.strict {
+		t.Fatal(args, opts)
+	}
+}
@@ -0,0 +1,84 @@
+package orm
+
+import (
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"reflect"
+)
+
+// targetStructType returns the struct type mapped by a Query target type
+func targetStructType(t reflect.Type) (reflect.Type, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("un support type:" + t.Kind().String())
+	}
+	return t, nil
+}
+
+// Find selects the rows of table matching where into ptr like Query, where may be empty.
+// Soft deleted rows are left out unless WithDeleted or OnlyDeleted is given among args.
+//
+//	err := orm.Find(config, "orders", &orders, "user_id = ? and status = ?", uid, 1, orm.Preload("Items"))
+func Find(db *mysql.DBConfig, table string, ptr interface{}, where string, args ...interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr {
+		return errors.New("v must be pointer")
+	}
+	t, err := targetStructType(rv.Type())
+	if err != nil {
+		return err
+	}
+	_, opts := splitArgs(args)
+	s, err := findSQL(table, t, where, opts)
+	if err != nil {
+		return err
+	}
+	return Query(db, s, ptr, args...)
+}
+
+func findSQL(table string, t reflect.Type, where string, opts *queryOptions) (string, error) {
+	scope, err := softDeleteScope(t, opts)
+	if err != nil {
+		return "", err
+	}
+	s := "select * from " + quote(table)
+	switch {
+	case where != "" && scope != "":
+		s += " where (" + where + ") and " + scope
+	case where != "":
+		s += " where " + where
+	case scope != "":
+		s += " where " + scope
+	}
+	return s, nil
+}
+
+// Get loads the row of table matching the pk fields of the struct pointed by ptr,
+// mysql.ErrorNotFound when there is none or it is soft deleted.
+func Get(db *mysql.DBConfig, table string, ptr interface{}, opts ...QueryOption) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	o := &queryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	pks, err := primaryKeys(namedFields(v.Type(), o.namingStrategy()))
+	if err != nil {
+		return err
+	}
+	where, args := whereClause(v, pks)
+	for _, opt := range opts {
+		args = append(args, opt)
+	}
+	return Find(db, table, ptr, where, args...)
+}
@@ -0,0 +1,179 @@
+package orm
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	NullPointer = "pointer" // nullable columns become *T
+	NullSQL     = "sql"     // nullable columns become sql.NullString, sql.NullInt64 ...
+)
+
+// GenerateOptions controls GenerateStructs
+type GenerateOptions struct {
+	// Package is the package clause of the output, "models" when empty
+	Package string
+	// NullStyle is NullPointer (default) or NullSQL
+	NullStyle string
+}
+
+// initialisms are upper cased as a whole in Go names, e.g. user_id -> UserID
+var initialisms = map[string]bool{
+	"id": true, "url": true, "uri": true, "ip": true, "uuid": true, "json": true, "api": true,
+	"http": true, "https": true, "sql": true, "html": true, "xml": true, "uid": true,
+}
+
+// GoName turns a snake_case table or column name into an exported Go name
+func GoName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '.'
+	}) {
+		lower := strings.ToLower(part)
+		if initialisms[lower] {
+			b.WriteString(strings.ToUpper(lower))
+			continue
+		}
+		r := []rune(part)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+	s := b.String()
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "T" + s
+	}
+	return s
+}
+
+// goType returns the Go type of c and the import it needs, if any
+func goType(c *ColumnSchema, nullStyle string) (string, string) {
+	t, imp := baseGoType(c)
+	if !c.Nullable || t == "[]byte" || t == "json.RawMessage" {
+		return t, imp
+	}
+	if nullStyle == NullSQL {
+		switch t {
+		case "string":
+			return "sql.NullString", "database/sql"
+		case "int64", "int":
+			return "sql.NullInt64", "database/sql"
+		case "float64", "float32":
+			return "sql.NullFloat64", "database/sql"
+		case "bool":
+			return "sql.NullBool", "database/sql"
+		case "time.Time":
+			return "sql.NullTime", "database/sql"
+		}
+	}
+	return "*" + t, imp
+}
+
+func baseGoType(c *ColumnSchema) (string, string) {
+	unsigned := c.IsUnsigned()
+	switch strings.ToLower(c.DataType) {
+	case "tinyint":
+		if strings.HasPrefix(strings.ToLower(c.ColumnType), "tinyint(1)") {
+			return "bool", ""
+		}
+		if unsigned {
+			return "uint", ""
+		}
+		return "int", ""
+	case "smallint", "mediumint", "int", "integer":
+		if unsigned {
+			return "uint", ""
+		}
+		return "int", ""
+	case "bigint":
+		if unsigned {
+			return "uint64", ""
+		}
+		return "int64", ""
+	case "float":
+		return "float32", ""
+	case "double", "real":
+		return "float64", ""
+	case "decimal", "numeric":
+		// keep the precision, float64 would round money
+		return "string", ""
+	case "date", "datetime", "timestamp":
+		return "time.Time", "time"
+	case "time":
+		return "time.Duration", "time"
+	case "year":
+		return "int", ""
+	case "json":
+		return "json.RawMessage", "encoding/json"
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob", "bit", "geometry":
+		return "[]byte", ""
+	}
+	return "string", ""
+}
+
+// GenerateStructs writes gofmt'ed Go structs with orm and json tags for tables.
+// The output only depends on the schema, so regenerated files can be diffed.
+func GenerateStructs(w io.Writer, tables []*TableSchema, opts GenerateOptions) error {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "models"
+	}
+	body := &bytes.Buffer{}
+	imports := make(map[string]bool)
+	for _, t := range tables {
+		name := GoName(t.Name)
+		comment := strings.Join(strings.Fields(t.Comment), " ")
+		if comment != "" {
+			fmt.Fprintf(body, "\n// %s maps table %s: %s\n", name, t.Name, comment)
+		} else {
+			fmt.Fprintf(body, "\n// %s maps table %s\n", name, t.Name)
+		}
+		fmt.Fprintf(body, "type %s struct {\n", name)
+		for _, c := range t.Columns {
+			typ, imp := goType(c, opts.NullStyle)
+			if imp != "" {
+				imports[imp] = true
+			}
+			ormTag := c.Name
+			if c.IsPrimaryKey() {
+				ormTag += "," + optPK
+			}
+			if c.IsAutoIncrement() {
+				ormTag += "," + optAutoIncrement
+			}
+			fmt.Fprintf(body, "\t%s %s `json:%q orm:%q`", GoName(c.Name), typ, c.Name, ormTag)
+			if comment := strings.Join(strings.Fields(c.Comment), " "); comment != "" {
+				fmt.Fprintf(body, " // %s", comment)
+			}
+			body.WriteString("\n")
+		}
+		body.WriteString("}\n")
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("// Code generated by ormgen from information_schema. DO NOT EDIT.\n\n")
+	fmt.Fprintf(out, "package %s\n", pkg)
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for p := range imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		out.WriteString("\nimport (\n")
+		for _, p := range paths {
+			fmt.Fprintf(out, "\t%q\n", p)
+		}
+		out.WriteString(")\n")
+	}
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,49 @@
+package orm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateStructs(t *testing.T) {
+	def := "0"
+	tables := []*TableSchema{{
+		Name:    "cust_customer",
+		Comment: "customer",
+		Columns: []*ColumnSchema{
+			{Name: "id", DataType: "bigint", ColumnType: "bigint(20) unsigned", Key: "PRI", Extra: "auto_increment"},
+			{Name: "mobile", DataType: "varchar", ColumnType: "varchar(20)", Nullable: true, Comment: "phone\nnumber"},
+			{Name: "vip", DataType: "tinyint", ColumnType: "tinyint(1)", Default: &def},
+			{Name: "create_time", DataType: "datetime", ColumnType: "datetime", Nullable: true},
+			{Name: "profile_json", DataType: "json", ColumnType: "json", Nullable: true},
+		},
+	}}
+	buf := &bytes.Buffer{}
+	if err := GenerateStructs(buf, tables, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	for _, want := range []string{
+		"package models",
+		"\t\"encoding/json\"\n\t\"time\"\n",
+		"// CustCustomer maps table cust_customer: customer",
+		"ID          uint64          `json:\"id\" orm:\"id,pk,autoincrement\"`",
+		"Mobile      *string         `json:\"mobile\" orm:\"mobile\"` // phone number",
+		"Vip         bool ",
+		"CreateTime  *time.Time ",
+		"ProfileJSON json.RawMessage ",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("missing %q in\n%s", want, src)
+		}
+	}
+
+	buf2 := &bytes.Buffer{}
+	if err := GenerateStructs(buf2, tables, GenerateOptions{Package: "m", NullStyle: NullSQL}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf2.String(), "sql.NullTime") || !strings.Contains(buf2.String(), "sql.NullString") {
+		t.Fatal(buf2.String())
+	}
+}
@@ -0,0 +1,65 @@
+package orm
+
+import (
+	"reflect"
+)
+
+// Hooks are optional interfaces of the model types, implemented on the pointer receiver.
+// An error of a Before hook aborts the operation before anything is written,
+// an error of an After hook is returned once the statement has run.
+//
+//	func (t *Token) BeforeInsert() error {
+//		t.CreateTime = time.Now()
+//		return nil
+//	}
+type (
+	// BeforeInserter is called by Insert before validation, so it may fill the fields checked by valid tags
+	BeforeInserter interface {
+		BeforeInsert() error
+	}
+	// AfterInserter is called by Insert once the row is written and the autoincrement fields filled
+	AfterInserter interface {
+		AfterInsert() error
+	}
+	// BeforeUpdater is called by Update before validation
+	BeforeUpdater interface {
+		BeforeUpdate() error
+	}
+	AfterUpdater interface {
+		AfterUpdate() error
+	}
+	BeforeDeleter interface {
+		BeforeDelete() error
+	}
+	AfterDeleter interface {
+		AfterDelete() error
+	}
+	// AfterFinder is called for every struct mapped by Query, KeyBy maps included, Iterator and Each once its row is scanned
+	AfterFinder interface {
+		AfterFind() error
+	}
+)
+
+// hookTarget returns the pointer to the struct held by v, nil when there is none
+func hookTarget(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			return v.Interface()
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return nil
+}
+
+func afterFind(v reflect.Value) error {
+	if h, ok := hookTarget(v).(AfterFinder); ok {
+		return h.AfterFind()
+	}
+	return nil
+}
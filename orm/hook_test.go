@@ -0,0 +1,91 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"strings"
+	"testing"
+)
+
+type hookUser struct {
+	ID    int64  `orm:"id,pk"`
+	Name  string `orm:"name"`
+	found int
+}
+
+var errorHookAbort = errors.New("abort")
+
+func (u *hookUser) AfterFind() error {
+	u.found++
+	u.Name = strings.ToUpper(u.Name)
+	if u.Name == "BAD" {
+		return errors.New("bad user")
+	}
+	return nil
+}
+
+func (u *hookUser) BeforeInsert() error { return errorHookAbort }
+func (u *hookUser) BeforeUpdate() error { return errorHookAbort }
+func (u *hookUser) BeforeDelete() error { return errorHookAbort }
+
+func TestAfterFind(t *testing.T) {
+	columns, types := []string{"id", "name"}, []string{"BIGINT", "VARCHAR"}
+	one := hookUser{}
+	if err := fakeScan(t, &one, columns, types, []driver.Value{int64(1), "tom"}); err != nil {
+		t.Fatal(err)
+	}
+	if one.found != 1 || one.Name != "TOM" {
+		t.Fatal(one)
+	}
+
+	list := make([]hookUser, 0)
+	if err := fakeScan(t, &list, columns, types, []driver.Value{int64(1), "tom"}, []driver.Value{int64(2), "amy"}); err != nil {
+		t.Fatal(err)
+	}
+	ptrs := make([]*hookUser, 0)
+	if err := fakeScan(t, &ptrs, columns, types, []driver.Value{int64(1), "tom"}, []driver.Value{int64(2), "amy"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range list {
+		if list[i].found != 1 || ptrs[i].found != 1 || list[i].Name != ptrs[i].Name || list[i].Name == strings.ToLower(list[i].Name) {
+			t.Fatal(list[i], ptrs[i])
+		}
+	}
+
+	if err := fakeScan(t, &list, columns, types, []driver.Value{int64(3), "bad"}); err == nil || err.Error() != "bad user" {
+		t.Fatal(err)
+	}
+	// the error does not depend on the shape of the target
+	if err := fakeScan(t, &one, columns, types, []driver.Value{int64(3), "bad"}); err == nil || err.Error() != "bad user" {
+		t.Fatal(err)
+	}
+
+	keyed := make(map[int64]*hookUser)
+	err := fakeScanWith(t, &keyed, &queryOptions{keyBy: "id"}, columns, types, []driver.Value{int64(1), "tom"}, []driver.Value{int64(2), "amy"})
+	if err != nil || len(keyed) != 2 || keyed[1].found != 1 || keyed[2].Name != "AMY" {
+		t.Fatal(keyed, err)
+	}
+	values := make(map[int64]hookUser)
+	if err := fakeScanWith(t, &values, &queryOptions{keyBy: "id"}, columns, types, []driver.Value{int64(1), "tom"}); err != nil || values[1].found != 1 {
+		t.Fatal(values, err)
+	}
+	if err := fakeScanWith(t, &keyed, &queryOptions{keyBy: "id"}, columns, types, []driver.Value{int64(3), "bad"}); err == nil || err.Error() != "bad user" {
+		t.Fatal(err)
+	}
+}
+
+func TestBeforeHookAborts(t *testing.T) {
+	// the config points nowhere, the hooks must fail before any connection is made
+	db := mysql.NewMySqlConfig("u", "p", "127.0.0.1", 1, "none")
+	u := &hookUser{ID: 1, Name: "tom"}
+	if err := Insert(db, "user", u); err != errorHookAbort {
+		t.Fatal(err)
+	}
+	if err := Update(db, "user", u); err != errorHookAbort {
+		t.Fatal(err)
+	}
+	if err := Delete(db, "user", u); err != errorHookAbort {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,169 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"reflect"
+)
+
+// ErrorStop ends Each early without error when returned by its callback
+var ErrorStop = errors.New("stop")
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Iterator maps a result one row at a time, it keeps memory flat on large results.
+//
+//	it, err := orm.Iterate(ctx, config, "select * from token")
+//	if err != nil { ... }
+//	defer it.Close()
+//	token := Token{}
+//	for it.Next() {
+//		if err := it.Scan(&token); err != nil { ... }
+//	}
+//	err = it.Err()
+type Iterator struct {
+	ctx      context.Context
+	rows     *sql.Rows
+	opts     *queryOptions
+	columns  []string
+	colTypes []*sql.ColumnType
+	scanners map[reflect.Type]rowScanner
+	err      error
+}
+
+// Iterate runs Sql with ctx and returns an Iterator over the rows, QueryOption values may be mixed into args.
+// Cancelling ctx stops the iteration and closes the rows.
+func Iterate(ctx context.Context, db *mysql.DBConfig, Sql string, args ...interface{}) (*Iterator, error) {
+	args, opts := splitArgs(args)
+	if opts.err != nil {
+		return nil, opts.err
+	}
+	rows, err := mysql.QueryRows(ctx, db, Sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(ctx, rows, opts)
+}
+
+func newIterator(ctx context.Context, rows *sql.Rows, opts *queryOptions) (*Iterator, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	return &Iterator{
+		ctx:      ctx,
+		rows:     rows,
+		opts:     opts,
+		columns:  columns,
+		colTypes: colTypes,
+		scanners: make(map[reflect.Type]rowScanner, 1),
+	}, nil
+}
+
+// Next prepares the next row, it returns false at the end of the result, on error or when ctx is done
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	return it.rows.Next()
+}
+
+// Scan maps the current row into ptr, a pointer to a struct, map or scalar
+func (it *Iterator) Scan(ptr interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("v must be pointer")
+	}
+	v := rv
+	if isScalarType(rv.Elem().Type()) {
+		v = rv.Elem()
+	}
+	scanner, ok := it.scanners[v.Type()]
+	if !ok {
+		var err error
+		if scanner, err = newRowScanner(v.Type(), it.columns, it.colTypes, it.opts); err != nil {
+			return err
+		}
+		it.scanners[v.Type()] = scanner
+	}
+	return scanRow(it.rows, scanner, v)
+}
+
+// Err returns the error that ended the iteration, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+// Close releases the rows, it is safe to call more than once
+func (it *Iterator) Close() error {
+	return it.rows.Close()
+}
+
+// Each runs Sql and calls fn, a func(row *T) error, once per row.
+// The same *T is reused and reset for every row, copy it to keep it.
+// Returning ErrorStop from fn ends the iteration without error, any other error is returned.
+func Each(db *mysql.DBConfig, Sql string, fn interface{}, args ...interface{}) error {
+	return EachContext(context.Background(), db, Sql, fn, args...)
+}
+
+// EachContext is Each stopping with ctx.Err() once ctx is done
+func EachContext(ctx context.Context, db *mysql.DBConfig, Sql string, fn interface{}, args ...interface{}) error {
+	fv, rowType, err := checkEachFunc(fn)
+	if err != nil {
+		return err
+	}
+	it, err := Iterate(ctx, db, Sql, args...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	return each(it, fv, rowType)
+}
+
+func checkEachFunc(fn interface{}) (reflect.Value, reflect.Type, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return reflect.Value{}, nil, errors.New("fn must be func(row *T) error")
+	}
+	ft := fv.Type()
+	if ft.NumIn() != 1 || ft.In(0).Kind() != reflect.Ptr ||
+		ft.NumOut() != 1 || ft.Out(0) != errorType {
+		return reflect.Value{}, nil, errors.New("fn must be func(row *T) error")
+	}
+	return fv, ft.In(0).Elem(), nil
+}
+
+func each(it *Iterator, fv reflect.Value, rowType reflect.Type) error {
+	row := reflect.New(rowType)
+	zero := reflect.Zero(rowType)
+	in := []reflect.Value{row}
+	for it.Next() {
+		row.Elem().Set(zero)
+		if err := it.Scan(row.Interface()); err != nil {
+			return err
+		}
+		if out := fv.Call(in)[0]; !out.IsNil() {
+			err := out.Interface().(error)
+			if err == ErrorStop {
+				return nil
+			}
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,62 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func fakeIterator(t *testing.T, ctx context.Context, n int) *Iterator {
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = tokenRow(i)
+	}
+	it, err := newIterator(ctx, fakeQuery(t, tokenColumns, tokenTypes, rows...), &queryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+func TestEach(t *testing.T) {
+	it := fakeIterator(t, context.Background(), 10)
+	defer it.Close()
+	seen := 0
+	fv, rowType, err := checkEachFunc(func(row *benchToken) error {
+		seen++
+		if row.TokenID == "token5" {
+			return ErrorStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := each(it, fv, rowType); err != nil || seen != 6 {
+		t.Fatal(seen, err)
+	}
+	if _, _, err := checkEachFunc(func(row benchToken) {}); err == nil {
+		t.Fatal("expected fn signature error")
+	}
+}
+
+func TestIteratorCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := fakeIterator(t, ctx, 10)
+	defer it.Close()
+	ids := make([]string, 0)
+	token := benchToken{}
+	for it.Next() {
+		if err := it.Scan(&token); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, token.TokenID)
+		if len(ids) == 3 {
+			cancel()
+		}
+	}
+	if len(ids) != 3 || it.Err() != context.Canceled {
+		t.Fatal(ids, it.Err())
+	}
+}
@@ -0,0 +1,120 @@
+package orm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NamingStrategy maps a struct field without orm tag name to its column.
+// Strategies are cache keys, create them once and reuse them.
+// They must be comparable, a strategy holding a map or a slice is used through a pointer.
+type NamingStrategy interface {
+	ColumnName(field reflect.StructField) string
+}
+
+// ErrorNamingNotComparable is returned for a strategy that can't be a cache key
+var ErrorNamingNotComparable = errors.New("naming strategy must be comparable, pass a pointer")
+
+func checkNaming(n NamingStrategy) error {
+	if n != nil && !reflect.TypeOf(n).Comparable() {
+		return ErrorNamingNotComparable
+	}
+	return nil
+}
+
+type funcNaming struct {
+	f func(name string) string
+}
+
+func (n *funcNaming) ColumnName(field reflect.StructField) string {
+	return n.f(field.Name)
+}
+
+// NamingFunc makes a strategy of a function of the Go field name
+func NamingFunc(f func(name string) string) NamingStrategy {
+	return &funcNaming{f: f}
+}
+
+type jsonNaming struct {
+	fallback NamingStrategy
+}
+
+func (n *jsonNaming) ColumnName(field reflect.StructField) string {
+	if name, _ := parseTag(field.Tag.Get("json")); name != "" && name != "-" {
+		return name
+	}
+	return n.fallback.ColumnName(field)
+}
+
+// JSONTag names columns after the json tag of the field, fallback is used for fields without one
+func JSONTag(fallback NamingStrategy) NamingStrategy {
+	return &jsonNaming{fallback: fallback}
+}
+
+var (
+	// SnakeCase maps CreateTime to create_time and UserID to user_id, it is the default
+	SnakeCase = NamingFunc(toSnakeCase)
+	// LowerCase maps CreateTime to createtime, the naming before strategies existed
+	LowerCase = NamingFunc(strings.ToLower)
+	// CamelCase maps CreateTime to createTime and UserID to userID
+	CamelCase = NamingFunc(toCamelCase)
+
+	naming   = SnakeCase
+	namingMu sync.RWMutex
+)
+
+// SetNamingStrategy changes the naming of untagged fields for every query and write,
+// call it at startup. Use the Naming option to change it for a single query.
+func SetNamingStrategy(n NamingStrategy) error {
+	if err := checkNaming(n); err != nil {
+		return err
+	}
+	if n == nil {
+		n = SnakeCase
+	}
+	namingMu.Lock()
+	naming = n
+	namingMu.Unlock()
+	return nil
+}
+
+func currentNaming() NamingStrategy {
+	namingMu.RLock()
+	defer namingMu.RUnlock()
+	return naming
+}
+
+func toSnakeCase(name string) string {
+	r := []rune(name)
+	b := &strings.Builder{}
+	for i, c := range r {
+		if unicode.IsUpper(c) {
+			// a new word starts after a lower case letter or digit, or at the last upper case letter of an acronym
+			if i > 0 && (unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1]) ||
+				(unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func toCamelCase(name string) string {
+	r := []rune(name)
+	for i := range r {
+		if !unicode.IsUpper(r[i]) {
+			break
+		}
+		// keep the first letter of the next word, e.g. HTTPServer -> httpServer
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
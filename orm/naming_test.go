@@ -0,0 +1,107 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestNamingFuncs(t *testing.T) {
+	cases := []struct{ in, snake, camel string }{
+		{"CreateTime", "create_time", "createTime"},
+		{"UserID", "user_id", "userID"},
+		{"ID", "id", "id"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"Address2City", "address2_city", "address2City"},
+		{"name", "name", "name"},
+	}
+	for _, c := range cases {
+		if s := toSnakeCase(c.in); s != c.snake {
+			t.Errorf("snake %s: %s", c.in, s)
+		}
+		if s := toCamelCase(c.in); s != c.camel {
+			t.Errorf("camel %s: %s", c.in, s)
+		}
+	}
+}
+
+type namingUser struct {
+	UserID     int64  `orm:"uid"`
+	CreateTime string `json:"created"`
+	NickName   string `json:"-"`
+}
+
+func TestNamingStrategy(t *testing.T) {
+	names := func(n NamingStrategy) []string {
+		res := make([]string, 0)
+		for _, f := range namedFields(reflect.TypeOf(namingUser{}), n) {
+			res = append(res, f.name)
+		}
+		return res
+	}
+	if n := names(SnakeCase); !reflect.DeepEqual(n, []string{"uid", "create_time", "nick_name"}) {
+		t.Fatal(n)
+	}
+	if n := names(LowerCase); !reflect.DeepEqual(n, []string{"uid", "createtime", "nickname"}) {
+		t.Fatal(n)
+	}
+	if n := names(JSONTag(CamelCase)); !reflect.DeepEqual(n, []string{"uid", "created", "nickName"}) {
+		t.Fatal(n)
+	}
+
+	columns, types := []string{"uid", "createtime"}, []string{"BIGINT", "VARCHAR"}
+	u := namingUser{}
+	if err := fakeScanWith(t, &u, &queryOptions{naming: LowerCase}, columns, types, []driver.Value{int64(1), "2020"}); err != nil {
+		t.Fatal(err)
+	}
+	if u.UserID != 1 || u.CreateTime != "2020" {
+		t.Fatal(u)
+	}
+	u = namingUser{}
+	if err := fakeScan(t, &u, columns, types, []driver.Value{int64(1), "2020"}); err != nil || u.CreateTime != "" {
+		t.Fatal(u, err)
+	}
+
+	SetNamingStrategy(LowerCase)
+	defer SetNamingStrategy(nil)
+	if err := fakeScan(t, &u, columns, types, []driver.Value{int64(1), "2020"}); err != nil || u.CreateTime != "2020" {
+		t.Fatal(u, err)
+	}
+}
+
+// mapNaming is not comparable, it can't be a cache key by value
+type mapNaming struct {
+	columns map[string]string
+}
+
+func (n mapNaming) ColumnName(field reflect.StructField) string {
+	return n.columns[field.Name]
+}
+
+func TestNamingNotComparable(t *testing.T) {
+	bad := mapNaming{columns: map[string]string{"UserID": "uid"}}
+	if err := SetNamingStrategy(bad); err != ErrorNamingNotComparable {
+		t.Fatal(err)
+	}
+	if currentNaming() != SnakeCase {
+		t.Fatal("strategy changed")
+	}
+	var u namingUser
+	if err := Query(nil, "select * from user", &u, Naming(bad)); err != ErrorNamingNotComparable {
+		t.Fatal(err)
+	}
+	if _, err := Iterate(context.Background(), nil, "select * from user", Naming(bad)); err != ErrorNamingNotComparable {
+		t.Fatal(err)
+	}
+	// a pointer is a fine key
+	columns, types := []string{"id", "uid"}, []string{"BIGINT", "BIGINT"}
+	type mapped struct {
+		ID     int64 `orm:"id"`
+		UserID int64
+	}
+	var m mapped
+	if err := fakeScanWith(t, &m, &queryOptions{naming: &bad}, columns, types, []driver.Value{int64(1), int64(2)}); err != nil || m.UserID != 2 {
+		t.Fatal(m, err)
+	}
+}
@@ -0,0 +1,170 @@
+package orm
+
+import (
+	"strings"
+	"time"
+)
+
+// QueryOption changes how Query maps rows, it is passed among the sql args:
+//
+//	orm.Query(config, "select * from token where account = ?", &res, orm.Strict(), account)
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	// strict returns a *MultiFieldError instead of logging conversion errors
+	strict bool
+	// keyBy is the column keying the rows of a map target
+	keyBy string
+	// preload are the relation paths loaded after the query
+	preload []string
+	// naming overrides the global NamingStrategy when set
+	naming NamingStrategy
+	// deleted is the soft delete scope of the queries built by the orm
+	deleted deletedScope
+	// decimal, decimalParser, loc and timeTypes shape the values of map targets
+	decimal       DecimalMode
+	decimalParser func(s string) (interface{}, error)
+	loc           *time.Location
+	timeTypes     map[string]bool
+	// err is a bad option, returned by the query
+	err error
+}
+
+func (o *queryOptions) namingStrategy() NamingStrategy {
+	if o.naming != nil {
+		return o.naming
+	}
+	return currentNaming()
+}
+
+// Strict makes Query fail with a *MultiFieldError on any conversion error, unmapped column or unmapped field.
+func Strict() QueryOption {
+	return func(o *queryOptions) {
+		o.strict = true
+	}
+}
+
+// Lenient logs conversion errors and leaves the zero value, it is the default.
+// Empty notEmpty fields, broken valid rules and AfterFind errors still fail the query,
+// for a single struct too: before valid rules and hooks existed a single struct only logged them.
+func Lenient() QueryOption {
+	return func(o *queryOptions) {
+		o.strict = false
+	}
+}
+
+// KeyBy makes Query fill a map[K]T target with one element per row, keyed by column.
+func KeyBy(column string) QueryOption {
+	return func(o *queryOptions) {
+		o.keyBy = column
+	}
+}
+
+// DecimalMode is how map targets hold DECIMAL columns
+type DecimalMode int
+
+const (
+	// DecimalFloat is a float64, it may lose precision, it is the default
+	DecimalFloat DecimalMode = iota
+	// DecimalString keeps the exact text, e.g. "12.30"
+	DecimalString
+	// DecimalRat is an exact *big.Rat
+	DecimalRat
+)
+
+// Decimals sets the representation of DECIMAL columns in map targets
+func Decimals(mode DecimalMode) QueryOption {
+	return func(o *queryOptions) {
+		o.decimal = mode
+	}
+}
+
+// DecimalParser makes map targets hold DECIMAL columns as returned by parse, e.g. a third party decimal type:
+//
+//	orm.DecimalParser(func(s string) (interface{}, error) { return decimal.NewFromString(s) })
+func DecimalParser(parse func(s string) (interface{}, error)) QueryOption {
+	return func(o *queryOptions) {
+		o.decimalParser = parse
+	}
+}
+
+// InLocation converts the time values of map targets to loc, it is also the zone of times read as text
+func InLocation(loc *time.Location) QueryOption {
+	return func(o *queryOptions) {
+		o.loc = loc
+	}
+}
+
+// TimeTypes lists the column types held as time.Time in map targets, among "date", "datetime",
+// "timestamp" and "year", "time" is held as time.Duration. By default DATETIME is formatted
+// with Layout and the other types are strings.
+//
+//	orm.Query(config, "select * from orders", &rows, orm.TimeTypes("date", "datetime", "timestamp"))
+func TimeTypes(types ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.timeTypes = make(map[string]bool, len(types))
+		for _, t := range types {
+			o.timeTypes[strings.ToLower(t)] = true
+		}
+	}
+}
+
+// Naming maps the untagged fields of this query with n instead of the global NamingStrategy
+//
+//	orm.Query(config, "select * from legacy_token", &res, orm.Naming(orm.LowerCase))
+func Naming(n NamingStrategy) QueryOption {
+	return func(o *queryOptions) {
+		if err := checkNaming(n); err != nil {
+			o.err = err
+			return
+		}
+		o.naming = n
+	}
+}
+
+// WithDeleted makes Find, Get and Preload return soft deleted rows as well
+func WithDeleted() QueryOption {
+	return func(o *queryOptions) {
+		o.deleted = scopeWithDeleted
+	}
+}
+
+// OnlyDeleted makes Find, Get and Preload return only soft deleted rows
+func OnlyDeleted() QueryOption {
+	return func(o *queryOptions) {
+		o.deleted = scopeOnlyDeleted
+	}
+}
+
+// Preload makes Query load the given relation fields once the rows are mapped, with one IN query per relation.
+// Nested relations are dotted paths of Go field names:
+//
+//	orm.Query(config, "select * from orders where user_id = ?", &orders, orm.Preload("Items", "Items.Product", "User"), uid)
+func Preload(relations ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.preload = append(o.preload, relations...)
+	}
+}
+
+// splitArgs separates the query options from the sql args
+func splitArgs(args []interface{}) ([]interface{}, *queryOptions) {
+	opts := &queryOptions{}
+	n := 0
+	for _, arg := range args {
+		if _, ok := arg.(QueryOption); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return args, opts
+	}
+	sqlArgs := make([]interface{}, 0, len(args)-n)
+	for _, arg := range args {
+		if o, ok := arg.(QueryOption); ok {
+			o(opts)
+		} else {
+			sqlArgs = append(sqlArgs, arg)
+		}
+	}
+	return sqlArgs, opts
+}
@@ -31,6 +31,8 @@ var (
 	Layout   = "2006-01-02 15:04:05" // datetime layout
 )
 
+// NewMapStringScan returns a scanner holding each row as map[string]string.
+// Query no longer goes through it, it is kept for callers scanning rows themselves.
 func NewMapStringScan(columnNames []string) *mapStringScan {
 	lenCN := len(columnNames)
 	s := &mapStringScan{
@@ -50,8 +52,13 @@ func (s *mapStringScan) Update(rows *sql.Rows) error {
 	if err := rows.Scan(s.cp...); err != nil {
 		return err
 	}
-	t, _ := rows.ColumnTypes()
-	s.colTypes = t
+	if len(s.colTypes) == 0 {
+		t, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		s.colTypes = t
+	}
 	for index := 0; index < s.colCount; index++ {
 		if rb, ok := s.cp[index].(*sql.RawBytes); ok {
 			s.row[s.colNames[index]] = string(*rb)
@@ -183,13 +190,13 @@ func (s *mapStringScan) Unmarshal(value reflect.Value) error {
 		// Structure field
 		fieldInfo := v.Type().Field(i)
 		tag := fieldInfo.Tag
-		name := tag.Get("orm")
-		if name == "-" {
+		ormTag := tag.Get("orm")
+		if ormTag == "-" {
 			continue
 		}
+		name, _ := parseTag(ormTag)
 		if utils.IsEmpty(name) {
-			// Structure field name is used by default
-			name = strings.ToLower(fieldInfo.Name)
+			name = currentNaming().ColumnName(fieldInfo)
 		}
 		// If empty or not transmitted, set to default
 		defaultValue := tag.Get("default")
@@ -348,70 +355,31 @@ func formatBool(source string) (bool, error) {
 	return i, err
 }
 
+// Query runs Sql and scans the result into ptr, a pointer to a map, struct or slice of those.
+// The field mapping of a struct type is computed once per column set and cached.
+// QueryOption values, e.g. Strict(), may be mixed into args.
 func Query(db *mysql.DBConfig, Sql string, ptr interface{}, args ...interface{}) error {
-	//if reflect.TypeOf(ptr).Kind() != reflect.Ptr {
-	//	return errors.New("v must be pointer")
-	//}
 	rv := reflect.ValueOf(ptr)
 	if rv.Kind() != reflect.Ptr {
 		return errors.New("v must be pointer")
 	}
-
-	pv := rv.Elem()
-
+	args, opts := splitArgs(args)
+	if opts.err != nil {
+		return opts.err
+	}
 	err := mysql.Query(db, Sql, func(rows *sql.Rows) error {
-		columns, err := rows.Columns()
-		if err != nil {
-			return err
-		}
-		mapScan := NewMapStringScan(columns)
-		isEmpty := true
-
-		i := 0
-		for rows.Next() {
-			isEmpty = false
-			err = mapScan.Update(rows)
-			if err != nil {
-				logger.Error(err)
-			} else {
-				result := mapScan.Get()
-				logger.Debug(result)
-			}
-			if pv.Kind() == reflect.Map || pv.Kind() == reflect.Struct {
-				err = mapScan.Unmarshal(rv)
-				if err != nil {
-					logger.Error(err)
-				}
-				break
-			} else if pv.Kind() == reflect.Slice {
-				//sliceItemType :=  pv.Elem().Kind()
-				if i >= pv.Cap() {
-					newcap := pv.Cap() + pv.Cap()/2
-					if newcap < 4 {
-						newcap = 4
-					}
-					newv := reflect.MakeSlice(pv.Type(), pv.Len(), newcap)
-					reflect.Copy(newv, pv)
-					pv.Set(newv)
-				}
-				if i >= pv.Len() {
-					pv.SetLen(i + 1)
-				}
-
-				err = mapScan.Unmarshal(pv.Index(i))
-				if err != nil {
-					logger.Error(err)
-					return err
-				}
-				i++
-			} else {
-				return errors.New("un support ptr type %s" + rv.Elem().Kind().String())
-			}
+		return scanRows(rows, rv, opts)
+	}, args...)
+	if err != nil || len(opts.preload) == 0 {
+		return err
+	}
+	return preload(func(s string, p interface{}, a ...interface{}) error {
+		if opts.strict {
+			a = append(a, Strict())
 		}
-		if isEmpty {
-			return mysql.ErrorNotFound
+		if opts.naming != nil {
+			a = append(a, Naming(opts.naming))
 		}
-		return nil
-	}, args...)
-	return err
+		return Query(db, s, p, a...)
+	}, rv, opts)
 }
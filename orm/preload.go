@@ -0,0 +1,330 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	relHasOne    = "hasone"
+	relHasMany   = "hasmany"
+	relBelongsTo = "belongsto"
+
+	// preloadBatch bounds the IN list of one preload query
+	preloadBatch = 1000
+)
+
+// relation is a struct field tagged rel, entries are separated by ";" like valid tags:
+//
+//	Items []*OrderItem `rel:"hasmany;table=order_item;fk=order_id"`     // order_item.order_id = order.id
+//	User  *User        `rel:"belongsto;table=user;fk=user_id"`          // order.user_id = user.id
+//	Addr  Address      `rel:"hasone;table=address;fk=user_id;ref=uid"`  // address.user_id = user.uid
+//
+// Soft deleted children are skipped unless WithDeleted or OnlyDeleted is given.
+// ref is the referenced column, the pk of the parent for hasone and hasmany, of the child
+// for belongsto, "id" when there is none. Relation fields are never read or written as columns.
+type relation struct {
+	kind   string
+	table  string
+	fk     string
+	ref    string
+	index  []int
+	typ    reflect.Type // field type
+	elem   reflect.Type // child struct type
+	many   bool
+	isPtr  bool // element is *C
+	parent reflect.Type
+	opts   *queryOptions
+}
+
+// queryFunc runs a child query the way Query does, it lets preload run without a database in tests
+type queryFunc func(Sql string, ptr interface{}, args ...interface{}) error
+
+func parseRelation(t reflect.Type, name string, opts *queryOptions) (*relation, error) {
+	sf, ok := t.FieldByName(name)
+	if !ok {
+		return nil, errors.New("unknown relation:" + name)
+	}
+	tag, ok := sf.Tag.Lookup("rel")
+	if !ok {
+		return nil, errors.New("field " + name + " has no rel tag")
+	}
+	r := &relation{index: sf.Index, typ: sf.Type, parent: t, opts: opts}
+	for _, text := range strings.Split(tag, ";") {
+		text = strings.TrimSpace(text)
+		key, param := text, ""
+		if i := strings.Index(text, "="); i != -1 {
+			key, param = text[:i], text[i+1:]
+		}
+		switch key {
+		case relHasOne, relHasMany, relBelongsTo:
+			r.kind = key
+		case "table":
+			r.table = param
+		case "fk":
+			r.fk = param
+		case "ref":
+			r.ref = param
+		case "":
+		default:
+			return nil, errors.New(name + ": unknown rel option " + key)
+		}
+	}
+	if r.kind == "" || r.table == "" || r.fk == "" {
+		return nil, errors.New(name + ": rel tag needs a kind, table and fk")
+	}
+	et := sf.Type
+	if r.many = et.Kind() == reflect.Slice; r.many {
+		et = et.Elem()
+	}
+	if r.isPtr = et.Kind() == reflect.Ptr; r.isPtr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return nil, errors.New(name + ": relation must be a struct, a pointer or a slice of them")
+	}
+	if r.many != (r.kind == relHasMany) {
+		return nil, errors.New(name + ": only hasmany relations are slices")
+	}
+	r.elem = et
+	if r.ref == "" {
+		owner := t
+		if r.kind == relBelongsTo {
+			owner = et
+		}
+		r.ref = "id"
+		if pks, err := primaryKeys(namedFields(owner, opts.namingStrategy())); err == nil {
+			r.ref = pks[0].name
+		}
+	}
+	return r, nil
+}
+
+// keys returns the parent and child columns matched by the relation
+func (r *relation) keys() (string, string) {
+	if r.kind == relBelongsTo {
+		return r.fk, r.ref
+	}
+	return r.ref, r.fk
+}
+
+func columnIndex(t reflect.Type, column string, n NamingStrategy) ([]int, error) {
+	for _, f := range namedFields(t, n) {
+		if f.name == column {
+			return f.index, nil
+		}
+	}
+	return nil, errors.New(t.String() + " has no column " + column)
+}
+
+// keyString returns the comparable form of a key value, false for NULL
+func keyString(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil || dv == nil {
+			return "", false
+		}
+		if b, ok := dv.([]byte); ok {
+			return string(b), true
+		}
+		return fmt.Sprint(dv), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// preloadTree groups dotted paths by their first element, "Items.Product" -> Items: [Product]
+func preloadTree(paths []string) (map[string][]string, []string) {
+	tree := make(map[string][]string)
+	names := make([]string, 0)
+	for _, p := range paths {
+		name, rest := p, ""
+		if i := strings.Index(p, "."); i != -1 {
+			name, rest = p[:i], p[i+1:]
+		}
+		sub, ok := tree[name]
+		if !ok {
+			names = append(names, name)
+		}
+		if rest != "" {
+			sub = append(sub, rest)
+		}
+		tree[name] = sub
+	}
+	sort.Strings(names)
+	return tree, names
+}
+
+// collectStructs returns the addressable structs held by the Query target v
+func collectStructs(v reflect.Value) ([]reflect.Value, reflect.Type, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{v}, v.Type(), nil
+	case reflect.Slice, reflect.Map:
+		et := v.Type().Elem()
+		for et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if et.Kind() != reflect.Struct {
+			break
+		}
+		if v.Kind() == reflect.Map && v.Type().Elem().Kind() != reflect.Ptr {
+			return nil, nil, errors.New("preload into a map needs pointer elements, e.g. map[int64]*T")
+		}
+		res := make([]reflect.Value, 0, v.Len())
+		add := func(e reflect.Value) {
+			for e.Kind() == reflect.Ptr {
+				if e.IsNil() {
+					return
+				}
+				e = e.Elem()
+			}
+			res = append(res, e)
+		}
+		if v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				add(v.Index(i))
+			}
+		} else {
+			iter := v.MapRange()
+			for iter.Next() {
+				add(iter.Value())
+			}
+		}
+		return res, et, nil
+	}
+	return nil, nil, errors.New("preload needs a struct target, un support type:" + v.Type().String())
+}
+
+func preload(q queryFunc, target reflect.Value, opts *queryOptions) error {
+	parents, t, err := collectStructs(target)
+	if err != nil || len(parents) == 0 {
+		return err
+	}
+	return preloadStructs(q, parents, t, opts.preload, opts)
+}
+
+func preloadStructs(q queryFunc, parents []reflect.Value, t reflect.Type, paths []string, opts *queryOptions) error {
+	tree, names := preloadTree(paths)
+	for _, name := range names {
+		r, err := parseRelation(t, name, opts)
+		if err != nil {
+			return err
+		}
+		if err = r.load(q, parents, tree[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load runs the IN query of the relation for parents and stitches the children into them
+func (r *relation) load(q queryFunc, parents []reflect.Value, nested []string) error {
+	parentCol, childCol := r.keys()
+	pIndex, err := columnIndex(r.parent, parentCol, r.opts.namingStrategy())
+	if err != nil {
+		return err
+	}
+	cIndex, err := columnIndex(r.elem, childCol, r.opts.namingStrategy())
+	if err != nil {
+		return err
+	}
+
+	args := make([]interface{}, 0, len(parents))
+	seen := make(map[string]bool, len(parents))
+	for _, p := range parents {
+		fv, ok := fieldByIndex(p, pIndex)
+		if !ok {
+			continue
+		}
+		if k, ok := keyString(fv); ok && !seen[k] {
+			seen[k] = true
+			args = append(args, fv.Interface())
+		}
+	}
+
+	scope, err := softDeleteScope(r.elem, r.opts)
+	if err != nil {
+		return err
+	}
+	if scope != "" {
+		scope = " and " + scope
+	}
+	children := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(r.elem)), 0, 0)
+	for start := 0; start < len(args); start += preloadBatch {
+		end := start + preloadBatch
+		if end > len(args) {
+			end = len(args)
+		}
+		batch := reflect.New(children.Type())
+		s := "select * from " + quote(r.table) + " where " + quote(childCol) + " in (" + placeholders(end-start) + ")" + scope
+		if err := q(s, batch.Interface(), args[start:end]...); err != nil && err != mysql.ErrorNotFound {
+			return err
+		}
+		children = reflect.AppendSlice(children, batch.Elem())
+	}
+
+	if len(nested) > 0 && children.Len() > 0 {
+		values := make([]reflect.Value, children.Len())
+		for i := range values {
+			values[i] = children.Index(i).Elem()
+		}
+		if err := preloadStructs(q, values, r.elem, nested, r.opts); err != nil {
+			return err
+		}
+	}
+
+	byKey := make(map[string][]reflect.Value, children.Len())
+	for i := 0; i < children.Len(); i++ {
+		c := children.Index(i)
+		if k, ok := keyString(c.Elem().FieldByIndex(cIndex)); ok {
+			byKey[k] = append(byKey[k], c)
+		}
+	}
+	for _, p := range parents {
+		fv, ok := fieldByIndex(p, pIndex)
+		if !ok {
+			continue
+		}
+		k, ok := keyString(fv)
+		if !ok {
+			continue
+		}
+		dst := p.FieldByIndex(r.index)
+		matched := byKey[k]
+		if r.many {
+			list := reflect.MakeSlice(r.typ, 0, len(matched))
+			for _, c := range matched {
+				list = reflect.Append(list, r.element(c))
+			}
+			dst.Set(list)
+		} else if len(matched) > 0 {
+			dst.Set(r.element(matched[0]))
+		}
+	}
+	return nil
+}
+
+// element converts a loaded *C into the element type of the relation field
+func (r *relation) element(c reflect.Value) reflect.Value {
+	if r.isPtr {
+		return c
+	}
+	return c.Elem()
+}
@@ -0,0 +1,92 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+type preloadProduct struct {
+	ID   int64  `orm:"id,pk"`
+	Name string `orm:"name"`
+}
+
+type preloadItem struct {
+	ID        int64           `orm:"id,pk"`
+	OrderID   int64           `orm:"order_id"`
+	ProductID int64           `orm:"product_id"`
+	Product   *preloadProduct `rel:"belongsto;table=product;fk=product_id"`
+}
+
+type preloadOrder struct {
+	ID    int64          `orm:"id,pk"`
+	No    string         `orm:"no"`
+	Items []*preloadItem `rel:"hasmany;table=order_item;fk=order_id"`
+	First preloadItem    `rel:"hasone;table=order_item;fk=order_id"`
+}
+
+// fakeQueryFunc serves the child queries of preload from canned results keyed by their sql
+func fakeQueryFunc(t *testing.T, results map[string]*fakeResult, ran *[]string) queryFunc {
+	fakeResultsMu.Lock()
+	for s, r := range results {
+		fakeResults[s] = r
+	}
+	fakeResultsMu.Unlock()
+	return func(s string, ptr interface{}, args ...interface{}) error {
+		*ran = append(*ran, s)
+		rows, err := fakeDB.Query(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		return scanRows(rows, reflect.ValueOf(ptr), &queryOptions{})
+	}
+}
+
+func TestPreload(t *testing.T) {
+	itemColumns, itemTypes := []string{"id", "order_id", "product_id"}, []string{"BIGINT", "BIGINT", "BIGINT"}
+	ran := make([]string, 0)
+	q := fakeQueryFunc(t, map[string]*fakeResult{
+		"select * from `order_item` where `order_id` in (?,?,?)": {columns: itemColumns, types: itemTypes, rows: [][]driver.Value{
+			{int64(10), int64(1), int64(100)}, {int64(11), int64(1), int64(101)}, {int64(12), int64(2), int64(100)},
+		}},
+		"select * from `product` where `id` in (?,?)": {columns: []string{"id", "name"}, types: []string{"BIGINT", "VARCHAR"}, rows: [][]driver.Value{
+			{int64(100), "pen"}, {int64(101), "ink"},
+		}},
+	}, &ran)
+
+	orders := []preloadOrder{{ID: 1}, {ID: 2}, {ID: 3}}
+	if err := preload(q, reflect.ValueOf(&orders), &queryOptions{preload: []string{"Items.Product", "Items", "First"}}); err != nil {
+		t.Fatal(err)
+	}
+	// First, Items, Items.Product: one query per relation
+	if len(ran) != 3 {
+		t.Fatal(ran)
+	}
+	if len(orders[0].Items) != 2 || len(orders[1].Items) != 1 || len(orders[2].Items) != 0 || orders[2].Items == nil {
+		t.Fatal(orders)
+	}
+	if orders[0].Items[1].Product == nil || orders[0].Items[1].Product.Name != "ink" || orders[1].Items[0].Product.Name != "pen" {
+		t.Fatal(orders[0].Items[1], orders[1].Items[0])
+	}
+	if orders[0].First.ID != 10 || orders[1].First.ID != 12 || orders[2].First.ID != 0 {
+		t.Fatal(orders[0].First, orders[1].First, orders[2].First)
+	}
+
+	one := &preloadOrder{ID: 1}
+	if err := preload(q, reflect.ValueOf(&one), &queryOptions{preload: []string{"Nope"}}); err == nil {
+		t.Fatal("expected unknown relation error")
+	}
+	keyed := map[int64]preloadOrder{1: {ID: 1}}
+	if err := preload(q, reflect.ValueOf(&keyed), &queryOptions{preload: []string{"Items"}}); err == nil {
+		t.Fatal("expected error for map of values")
+	}
+}
+
+func TestRelationNotColumn(t *testing.T) {
+	for _, f := range typeFields(reflect.TypeOf(preloadOrder{})) {
+		if f.fieldName == "Items" || f.fieldName == "First" {
+			t.Fatal("relation mapped as column")
+		}
+	}
+}
@@ -0,0 +1,907 @@
+package orm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"github.com/yanzongzhen/Logger/logger"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// fieldDecoder converts a driver value (nil, []byte, string, int64, float64, bool or time.Time) into dst
+type fieldDecoder func(dst reflect.Value, src interface{}) error
+
+// columnPlan maps one result column to a struct field
+type columnPlan struct {
+	index        []int
+	fieldName    string
+	defaultValue string
+	notEmpty     bool
+	decode       fieldDecoder
+	// decodeDefault decodes defaultValue, it is plain text even for an encrypted field
+	decodeDefault fieldDecoder
+}
+
+// structPlan is the field mapping of a struct type for a given column set.
+// It is computed once and cached, rows are then scanned straight into the fields.
+type structPlan struct {
+	// columns has one entry per result column, nil when the column is not mapped
+	columns []*columnPlan
+	// err is returned for every row, e.g. a notEmpty field without column
+	err error
+	// unmapped lists the columns without field and the fields without column
+	unmapped []*FieldError
+	// rules are the valid tag rules checked once a row is scanned, nil when there are none
+	rules *typeRules
+	// selected are the result columns, fields that are not selected aren't validated
+	selected map[string]bool
+}
+
+type planKey struct {
+	typ     reflect.Type
+	columns string
+	naming  NamingStrategy
+}
+
+var planCache sync.Map // map[planKey]*structPlan
+
+func getStructPlan(t reflect.Type, columns []string, n NamingStrategy) *structPlan {
+	key := planKey{typ: t, columns: strings.Join(columns, "\x00"), naming: n}
+	if p, ok := planCache.Load(key); ok {
+		return p.(*structPlan)
+	}
+	p, _ := planCache.LoadOrStore(key, newStructPlan(t, columns, n))
+	return p.(*structPlan)
+}
+
+func newStructPlan(t reflect.Type, columns []string, n NamingStrategy) *structPlan {
+	p := &structPlan{columns: make([]*columnPlan, len(columns))}
+	byName := make(map[string]int, len(columns))
+	for i, c := range columns {
+		byName[c] = i
+	}
+	blind := make(map[string]bool)
+	for _, f := range namedFields(t, n) {
+		decode := newFieldDecoder(f.typ)
+		if f.json {
+			decode = decodeJSON
+		}
+		decodeDefault := decode
+		if f.encrypt {
+			decode = decryptDecoder(decode)
+		}
+		if f.blind != "" {
+			blind[f.blind] = true
+		}
+		cp := &columnPlan{
+			index:         f.index,
+			fieldName:     f.fieldName,
+			defaultValue:  f.tag.Get("default"),
+			notEmpty:      parseValidTag(f.tag.Get("valid")).notEmpty,
+			decode:        decode,
+			decodeDefault: decodeDefault,
+		}
+		ci, ok := byName[f.name]
+		if !ok {
+			if cp.notEmpty && cp.defaultValue == "" && p.err == nil {
+				p.err = errors.New(f.fieldName + " value not empty")
+			}
+			p.unmapped = append(p.unmapped, &FieldError{Row: -1, Field: f.fieldName, Reason: "no column " + strconv.Quote(f.name)})
+			continue
+		}
+		p.columns[ci] = cp
+	}
+	for i, c := range columns {
+		if p.columns[i] == nil && !blind[c] {
+			p.unmapped = append(p.unmapped, &FieldError{Row: -1, Column: c, Reason: "no field"})
+		}
+	}
+	if tr := getTypeRules(t, n); tr.err != nil {
+		p.err = tr.err
+	} else if tr.hasRules() {
+		p.rules = tr
+		p.selected = make(map[string]bool, len(columns))
+		for _, c := range columns {
+			p.selected[c] = true
+		}
+	}
+	if len(p.unmapped) > 0 {
+		logger.Debugf("orm %s unmapped: %v", t, &MultiFieldError{Errors: p.unmapped})
+	}
+	return p
+}
+
+func newFieldDecoder(t reflect.Type) fieldDecoder {
+	if c, ok := lookupConverter(t); ok {
+		return zeroOnNull(newConverterDecoder(t, c))
+	}
+	if t.Kind() == reflect.Ptr {
+		return newPtrDecoder(t)
+	}
+	if t != timeType {
+		if reflect.PtrTo(t).Implements(scannerType) {
+			// sql.NullString, sql.NullTime, decimal and uuid types ...
+			return decodeScanner
+		}
+		if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+			return zeroOnNull(decodeText)
+		}
+	}
+	return zeroOnNull(newValueDecoder(t))
+}
+
+func newValueDecoder(t reflect.Type) fieldDecoder {
+	if t == timeType {
+		return decodeTime
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return decodeString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return decodeUint
+	case reflect.Bool:
+		return decodeBool
+	case reflect.Float32, reflect.Float64:
+		return decodeFloat
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return decodeBytes
+		}
+	}
+	return decodeUnsupported
+}
+
+// zeroOnNull sets dst to its zero value for NULL instead of failing to parse it
+func zeroOnNull(decode fieldDecoder) fieldDecoder {
+	return func(dst reflect.Value, src interface{}) error {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		return decode(dst, src)
+	}
+}
+
+// newPtrDecoder sets a *T field to nil for NULL, otherwise decodes into a new T
+func newPtrDecoder(t reflect.Type) fieldDecoder {
+	decode := newFieldDecoder(t.Elem())
+	return func(dst reflect.Value, src interface{}) error {
+		if src == nil {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(t.Elem()))
+		}
+		return decode(dst.Elem(), src)
+	}
+}
+
+func decodeScanner(dst reflect.Value, src interface{}) error {
+	return dst.Addr().Interface().(sql.Scanner).Scan(src)
+}
+
+func parseError(src interface{}, dst reflect.Value) error {
+	return fmt.Errorf("can't parse %s to %s", asString(src), dst.Type())
+}
+
+// asString formats a driver value the way sql.RawBytes would hold it
+func asString(src interface{}) string {
+	switch s := src.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(s)
+	case string:
+		return s
+	case int64:
+		return strconv.FormatInt(s, 10)
+	case float64:
+		return strconv.FormatFloat(s, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(s)
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(src)
+}
+
+func isEmptySrc(src interface{}) bool {
+	switch s := src.(type) {
+	case nil:
+		return true
+	case []byte:
+		return len(s) == 0
+	case string:
+		return len(s) == 0
+	}
+	return false
+}
+
+func decodeString(dst reflect.Value, src interface{}) error {
+	dst.SetString(asString(src))
+	return nil
+}
+
+// decodeBytes copies the value, the driver reuses its buffer on the next row
+func decodeBytes(dst reflect.Value, src interface{}) error {
+	b := asBytes(src)
+	value := reflect.MakeSlice(dst.Type(), len(b), len(b))
+	reflect.Copy(value, reflect.ValueOf(b))
+	dst.Set(value)
+	return nil
+}
+
+func decodeInt(dst reflect.Value, src interface{}) error {
+	var n int64
+	if i, ok := src.(int64); ok {
+		n = i
+	} else {
+		var err error
+		if n, err = strconv.ParseInt(asString(src), 10, 64); err != nil {
+			return parseError(src, dst)
+		}
+	}
+	if dst.OverflowInt(n) {
+		return parseError(src, dst)
+	}
+	dst.SetInt(n)
+	return nil
+}
+
+func decodeUint(dst reflect.Value, src interface{}) error {
+	var n uint64
+	if i, ok := src.(int64); ok && i >= 0 {
+		n = uint64(i)
+	} else {
+		var err error
+		if n, err = strconv.ParseUint(asString(src), 10, 64); err != nil {
+			return parseError(src, dst)
+		}
+	}
+	if dst.OverflowUint(n) {
+		return parseError(src, dst)
+	}
+	dst.SetUint(n)
+	return nil
+}
+
+func decodeBool(dst reflect.Value, src interface{}) error {
+	switch s := src.(type) {
+	case bool:
+		dst.SetBool(s)
+	case int64:
+		dst.SetBool(s != 0)
+	default:
+		value := asString(src)
+		dst.SetBool(value == "1" || value == "true")
+	}
+	return nil
+}
+
+func decodeFloat(dst reflect.Value, src interface{}) error {
+	var n float64
+	switch s := src.(type) {
+	case float64:
+		n = s
+	case int64:
+		n = float64(s)
+	default:
+		var err error
+		if n, err = strconv.ParseFloat(asString(src), dst.Type().Bits()); err != nil {
+			return parseError(src, dst)
+		}
+	}
+	if dst.OverflowFloat(n) {
+		return parseError(src, dst)
+	}
+	dst.SetFloat(n)
+	return nil
+}
+
+func decodeTime(dst reflect.Value, src interface{}) error {
+	if t, ok := src.(time.Time); ok {
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	value := asString(src)
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		if t, err = time.ParseInLocation(Layout, value, time.Local); err != nil {
+			return parseError(src, dst)
+		}
+	}
+	dst.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// decodeJSON unmarshals a JSON column into a struct, slice or map field, NULL leaves the zero value
+func decodeJSON(dst reflect.Value, src interface{}) error {
+	dst.Set(reflect.Zero(dst.Type()))
+	if isEmptySrc(src) {
+		return nil
+	}
+	return json.Unmarshal(asBytes(src), dst.Addr().Interface())
+}
+
+func decodeUnsupported(dst reflect.Value, src interface{}) error {
+	return parseError(src, dst)
+}
+
+// rowScanner maps the current row of rows into a value
+type rowScanner interface {
+	// bind points the scan destinations at v
+	bind(v reflect.Value)
+	// dest returns the destinations handed to rows.Scan
+	dest() []interface{}
+	// finish checks the row once rows.Scan has filled the destinations
+	finish() error
+}
+
+// scanRow scans the current row of rows into v
+func scanRow(rows *sql.Rows, s rowScanner, v reflect.Value) error {
+	s.bind(v)
+	if err := rows.Scan(s.dest()...); err != nil {
+		return err
+	}
+	if err := s.finish(); err != nil {
+		return err
+	}
+	return afterFind(v)
+}
+
+// isScalarType reports whether t is decoded from a single column, e.g. int64, string, time.Time or []byte
+func isScalarType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return isValueType(t)
+	}
+	return false
+}
+
+// newRowScanner returns the scanner of a t value, t may be a pointer to a struct or map
+func newRowScanner(t reflect.Type, columns []string, colTypes []*sql.ColumnType, opts *queryOptions) (rowScanner, error) {
+	if isScalarType(t) {
+		if len(columns) != 1 {
+			return nil, errors.New("scalar target needs 1 column, got " + strconv.Itoa(len(columns)))
+		}
+		plan := &structPlan{columns: []*columnPlan{{decode: newFieldDecoder(t)}}}
+		s := newStructScanner(plan, columns, opts)
+		s.scalar = true
+		return s, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, errors.New("key type not support:" + t.Key().Kind().String())
+		}
+		return newMapScanner(t, columns, colTypes, opts), nil
+	case reflect.Struct:
+		plan := getStructPlan(t, columns, opts.namingStrategy())
+		if opts.strict && len(plan.unmapped) > 0 {
+			return nil, &MultiFieldError{Errors: plan.unmapped}
+		}
+		return newStructScanner(plan, columns, opts), nil
+	}
+	return nil, errors.New("un support type:" + t.Kind().String())
+}
+
+// fieldScanner is the sql.Scanner handed to rows.Scan for one column, it decodes into the field of row
+type fieldScanner struct {
+	plan *columnPlan
+	row  reflect.Value
+	err  error
+	// raw is the column value when err is set
+	raw string
+	// empty is set when err is a notEmpty violation, Query fails on it even when lenient
+	empty bool
+}
+
+func (f *fieldScanner) Scan(src interface{}) error {
+	f.err, f.empty = nil, false
+	if f.plan == nil {
+		return nil
+	}
+	decode := f.plan.decode
+	// default only replaces NULL, an empty string is a value of its own
+	if src == nil && f.plan.defaultValue != "" {
+		src, decode = f.plan.defaultValue, f.plan.decodeDefault
+	}
+	if f.plan.notEmpty && isEmptySrc(src) {
+		f.err, f.empty = errors.New(f.plan.fieldName+" value not empty"), true
+		return nil
+	}
+	if src == nil {
+		// a NULL doesn't allocate nil embedded pointers, e.g. the child of a left join
+		if dst, ok := fieldByIndex(f.row, f.plan.index); ok {
+			f.err = decode(dst, src)
+		}
+	} else {
+		f.err = decode(fieldByIndexAlloc(f.row, f.plan.index), src)
+	}
+	if f.err != nil {
+		f.raw = asString(src)
+	}
+	return nil
+}
+
+// structScanner scans into the fields of a struct, or into the value itself when scalar
+type structScanner struct {
+	plan     *structPlan
+	columns  []string
+	opts     *queryOptions
+	scanners []fieldScanner
+	dests    []interface{}
+	row      int
+	scalar   bool
+}
+
+func newStructScanner(plan *structPlan, columns []string, opts *queryOptions) *structScanner {
+	s := &structScanner{
+		plan:     plan,
+		columns:  columns,
+		opts:     opts,
+		scanners: make([]fieldScanner, len(plan.columns)),
+		dests:    make([]interface{}, len(plan.columns)),
+	}
+	for i := range s.scanners {
+		s.scanners[i].plan = plan.columns[i]
+		s.dests[i] = &s.scanners[i]
+	}
+	return s
+}
+
+func (s *structScanner) bind(v reflect.Value) {
+	if !s.scalar {
+		v = indirect(v, false)
+	}
+	for i := range s.scanners {
+		s.scanners[i].row = v
+	}
+}
+
+func (s *structScanner) dest() []interface{} {
+	return s.dests
+}
+
+func (s *structScanner) finish() error {
+	if s.plan.err != nil {
+		return s.plan.err
+	}
+	row := s.row
+	s.row++
+	if s.opts.strict {
+		errs := &MultiFieldError{}
+		for i := range s.scanners {
+			f := &s.scanners[i]
+			if f.err != nil {
+				errs.add(&FieldError{Row: row, Column: s.columns[i], Field: f.plan.fieldName, Value: f.raw, Reason: f.err.Error()})
+			}
+		}
+		s.validate(row, errs)
+		return errs.errOrNil()
+	}
+	for i := range s.scanners {
+		f := &s.scanners[i]
+		if f.empty {
+			return f.err
+		}
+		if f.err != nil {
+			logger.Error(f.err)
+		}
+	}
+	// broken valid rules fail the row even when lenient
+	errs := &MultiFieldError{}
+	s.validate(row, errs)
+	return errs.errOrNil()
+}
+
+func (s *structScanner) validate(row int, errs *MultiFieldError) {
+	if s.plan.rules == nil || s.scalar || len(s.scanners) == 0 {
+		return
+	}
+	s.plan.rules.validate(s.scanners[0].row, row, true, s.plan.selected, errs)
+}
+
+const (
+	mapString = iota
+	mapInt
+	mapUint
+	mapFloat
+	mapDecimal
+	mapDatetime
+	mapTime
+	mapDuration
+	mapJSON
+)
+
+// timeLayouts are tried in order on times read as text
+var timeLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02", time.RFC3339Nano, "2006"}
+
+// mapColumn is the sql.Scanner of one map mode column, it converts by database column type
+type mapColumn struct {
+	kind  int
+	opts  *queryOptions
+	value interface{}
+	err   error
+	raw   string
+}
+
+func (c *mapColumn) Scan(src interface{}) error {
+	c.value, c.err = nil, nil
+	if src == nil {
+		return nil
+	}
+	defer func() {
+		if c.err != nil {
+			c.raw = asString(src)
+		}
+	}()
+	switch c.kind {
+	case mapInt:
+		if i, ok := src.(int64); ok {
+			c.value = i
+		} else {
+			c.value, c.err = formatInt(asString(src))
+		}
+	case mapUint:
+		// unsigned BIGINT may exceed math.MaxInt64, every value is an uint64 so the type does not depend on it
+		if i, ok := src.(int64); ok && i >= 0 {
+			c.value = uint64(i)
+		} else if u, err := strconv.ParseUint(asString(src), 10, 64); err == nil {
+			c.value = u
+		} else {
+			c.err = errors.New("param type not match,require:uint")
+		}
+	case mapFloat:
+		if f, ok := src.(float64); ok {
+			c.value = f
+		} else {
+			c.value, c.err = formatFloat(asString(src))
+		}
+	case mapDecimal:
+		c.value, c.err = c.decimal(asString(src))
+	case mapDatetime:
+		if t, ok := src.(time.Time); ok {
+			c.value = c.inLocation(t).Format(Layout)
+		} else {
+			c.value = formatDatetime(asString(src))
+		}
+	case mapTime:
+		if t, ok := src.(time.Time); ok {
+			c.value = c.inLocation(t)
+		} else {
+			c.value, c.err = c.parseTime(asString(src))
+		}
+	case mapDuration:
+		c.value, c.err = parseDuration(asBytes(src))
+	case mapJSON:
+		var value interface{}
+		c.err = json.Unmarshal(asBytes(src), &value)
+		c.value = value
+	default:
+		c.value = asString(src)
+	}
+	return nil
+}
+
+func (c *mapColumn) decimal(s string) (interface{}, error) {
+	if c.opts.decimalParser != nil {
+		return c.opts.decimalParser(s)
+	}
+	switch c.opts.decimal {
+	case DecimalString:
+		return s, nil
+	case DecimalRat:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, errors.New("param type not match,require:decimal")
+		}
+		return r, nil
+	}
+	return formatFloat(s)
+}
+
+func (c *mapColumn) inLocation(t time.Time) time.Time {
+	if c.opts.loc != nil {
+		return t.In(c.opts.loc)
+	}
+	return t
+}
+
+func (c *mapColumn) parseTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "0000-00-00") || s == "0000" {
+		return time.Time{}, nil
+	}
+	loc := c.opts.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.In(loc), nil
+		}
+	}
+	return time.Time{}, errors.New("param type not match,require:time")
+}
+
+type mapScanner struct {
+	names   []string
+	opts    *queryOptions
+	keys    []reflect.Value
+	columns []mapColumn
+	dests   []interface{}
+	row     int
+	target  reflect.Value
+}
+
+func newMapScanner(t reflect.Type, columns []string, colTypes []*sql.ColumnType, opts *queryOptions) *mapScanner {
+	s := &mapScanner{
+		names:   columns,
+		opts:    opts,
+		keys:    make([]reflect.Value, len(columns)),
+		columns: make([]mapColumn, len(columns)),
+		dests:   make([]interface{}, len(columns)),
+	}
+	for i, c := range columns {
+		s.keys[i] = reflect.ValueOf(c).Convert(t.Key())
+		s.columns[i].opts = opts
+		if i < len(colTypes) {
+			// newer drivers name unsigned columns "UNSIGNED BIGINT"
+			name := strings.ToLower(colTypes[i].DatabaseTypeName())
+			typ := strings.TrimPrefix(name, "unsigned ")
+			switch typ {
+			case "bigint":
+				s.columns[i].kind = mapInt
+				if typ != name {
+					s.columns[i].kind = mapUint
+				}
+			case "integer", "tinyint", "smallint", "mediumint", "int":
+				s.columns[i].kind = mapInt
+			case "double", "float":
+				s.columns[i].kind = mapFloat
+			case "decimal":
+				s.columns[i].kind = mapDecimal
+			case "datetime":
+				s.columns[i].kind = mapDatetime
+			case "json":
+				s.columns[i].kind = mapJSON
+			}
+			if opts.timeTypes[typ] {
+				switch typ {
+				case "date", "datetime", "timestamp", "year":
+					s.columns[i].kind = mapTime
+				case "time":
+					s.columns[i].kind = mapDuration
+				}
+			}
+		}
+		s.dests[i] = &s.columns[i]
+	}
+	return s
+}
+
+func (s *mapScanner) bind(v reflect.Value) {
+	s.target = v
+}
+
+func (s *mapScanner) dest() []interface{} {
+	return s.dests
+}
+
+func (s *mapScanner) finish() error {
+	v := indirect(s.target, false)
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	row := s.row
+	s.row++
+	errs := &MultiFieldError{}
+	elemType := v.Type().Elem()
+	for i := range s.columns {
+		c := &s.columns[i]
+		if c.err != nil {
+			if !s.opts.strict {
+				return c.err
+			}
+			errs.add(&FieldError{Row: row, Column: s.names[i], Value: c.raw, Reason: c.err.Error()})
+			continue
+		}
+		value := reflect.ValueOf(c.value)
+		if c.value == nil {
+			// NULL
+			value = reflect.Zero(elemType)
+		} else if elemType.Kind() == reflect.String {
+			value = reflect.ValueOf(asString(c.value)).Convert(elemType)
+		} else if !value.Type().AssignableTo(elemType) {
+			return errors.New("map value type not support:" + elemType.String())
+		}
+		v.SetMapIndex(s.keys[i], value)
+	}
+	return errs.errOrNil()
+}
+
+// keyScanner tees the key column of a KeyBy query into key before handing it to the element scanner
+type keyScanner struct {
+	next   interface{}
+	decode fieldDecoder
+	key    reflect.Value
+	err    error
+}
+
+func (k *keyScanner) Scan(src interface{}) error {
+	k.err = k.decode(k.key, src)
+	if next, ok := k.next.(sql.Scanner); ok {
+		return next.Scan(src)
+	}
+	return nil
+}
+
+// scanRows scans rows into the value pointed by rv: a struct, map or scalar, a slice of those,
+// or with KeyBy a map of those keyed by a column.
+// A strict scan stops at the first row with errors and returns all of them as a *MultiFieldError.
+func scanRows(rows *sql.Rows, rv reflect.Value, opts *queryOptions) error {
+	pv := rv.Elem()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	if isScalarType(pv.Type()) {
+		return scanOne(rows, pv, columns, colTypes, opts)
+	}
+	target := indirect(pv, false)
+	switch {
+	case target.Kind() == reflect.Slice:
+		return scanSlice(rows, target, columns, colTypes, opts)
+	case target.Kind() == reflect.Map && opts.keyBy != "":
+		return scanKeyed(rows, target, columns, colTypes, opts)
+	}
+	return scanOne(rows, rv, columns, colTypes, opts)
+}
+
+// scanOne scans the first row into v, conversion errors are only logged unless strict.
+// Broken valid rules and empty notEmpty fields fail the row like for a slice.
+func scanOne(rows *sql.Rows, v reflect.Value, columns []string, colTypes []*sql.ColumnType, opts *queryOptions) error {
+	scanner, err := newRowScanner(v.Type(), columns, colTypes, opts)
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return mysql.ErrorNotFound
+	}
+	scanner.bind(v)
+	if err = rows.Scan(scanner.dest()...); err == nil {
+		err = scanner.finish()
+	}
+	if err != nil {
+		logger.Error(err)
+		// a lenient struct scanner only reports what must fail the row, a map scanner its conversion errors
+		if _, isMap := scanner.(*mapScanner); opts.strict || !isMap {
+			return err
+		}
+		return nil
+	}
+	// like for a slice, a hook error is returned lenient or not
+	return afterFind(v)
+}
+
+func scanSlice(rows *sql.Rows, pv reflect.Value, columns []string, colTypes []*sql.ColumnType, opts *queryOptions) error {
+	scanner, err := newRowScanner(pv.Type().Elem(), columns, colTypes, opts)
+	if err != nil {
+		return err
+	}
+	i := 0
+	for rows.Next() {
+		if i >= pv.Cap() {
+			newcap := pv.Cap() + pv.Cap()/2
+			if newcap < 4 {
+				newcap = 4
+			}
+			newv := reflect.MakeSlice(pv.Type(), pv.Len(), newcap)
+			reflect.Copy(newv, pv)
+			pv.Set(newv)
+		}
+		if i >= pv.Len() {
+			pv.SetLen(i + 1)
+		}
+		if err = scanRow(rows, scanner, pv.Index(i)); err != nil {
+			logger.Error(err)
+			return err
+		}
+		i++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if i == 0 {
+		return mysql.ErrorNotFound
+	}
+	return nil
+}
+
+// scanKeyed scans every row into a new map element keyed by the opts.keyBy column
+func scanKeyed(rows *sql.Rows, m reflect.Value, columns []string, colTypes []*sql.ColumnType, opts *queryOptions) error {
+	t := m.Type()
+	keyIndex := -1
+	for i, c := range columns {
+		if c == opts.keyBy {
+			keyIndex = i
+		}
+	}
+	if keyIndex == -1 {
+		return errors.New("no key column:" + opts.keyBy)
+	}
+	scanner, err := newRowScanner(t.Elem(), columns, colTypes, opts)
+	if err != nil {
+		return err
+	}
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(t))
+	}
+	key := reflect.New(t.Key()).Elem()
+	tee := &keyScanner{decode: newFieldDecoder(t.Key()), key: key}
+	dest := make([]interface{}, len(columns))
+	n := 0
+	for rows.Next() {
+		elem := reflect.New(t.Elem()).Elem()
+		scanner.bind(elem)
+		copy(dest, scanner.dest())
+		tee.next = dest[keyIndex]
+		dest[keyIndex] = tee
+		if err = rows.Scan(dest...); err == nil {
+			if err = scanner.finish(); err == nil && tee.err != nil {
+				err = tee.err
+			}
+		}
+		if err == nil {
+			err = afterFind(elem)
+		}
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+		m.SetMapIndex(key, elem)
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return mysql.ErrorNotFound
+	}
+	return nil
+}
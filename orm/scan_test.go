@@ -0,0 +1,363 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	tokenColumns = []string{"token_id", "account", "device_type", "device_id", "type", "expire", "create_time"}
+	tokenTypes   = []string{"VARCHAR", "VARCHAR", "VARCHAR", "VARCHAR", "INT", "DATETIME", "DATETIME"}
+)
+
+func tokenRow(i int) []driver.Value {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []driver.Value{
+		[]byte("token" + strconv.Itoa(i)), []byte("account"), []byte("ios"), []byte("device"),
+		[]byte(strconv.Itoa(i % 3)), []byte(now.Format(time.RFC3339)), now,
+	}
+}
+
+type benchToken struct {
+	TokenID    string    `orm:"token_id"`
+	Account    string    `orm:"account"`
+	DeviceType string    `orm:"device_type"`
+	DeviceID   string    `orm:"device_id"`
+	Type       int       `orm:"type"`
+	Expire     time.Time `orm:"expire"`
+	CreateTime time.Time `orm:"create_time"`
+}
+
+func TestScanRowsStruct(t *testing.T) {
+	res := make([]benchToken, 0)
+	if err := fakeScan(t, &res, tokenColumns, tokenTypes, tokenRow(1), tokenRow(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[1].TokenID != "token2" || res[1].Type != 2 || res[0].Expire.Year() != 2020 || res[0].CreateTime.Day() != 2 {
+		t.Fatal(res)
+	}
+
+	one := Token{}
+	if err := fakeScan(t, &one, tokenColumns, tokenTypes, tokenRow(7)); err != nil {
+		t.Fatal(err)
+	}
+	if one.TokenID != "token7" || one.Type != 1 {
+		t.Fatal(one)
+	}
+}
+
+func TestScanRowsMap(t *testing.T) {
+	res := make([]map[string]interface{}, 0)
+	if err := fakeScan(t, &res, tokenColumns, tokenTypes, tokenRow(5)); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["type"] != int64(2) || res[0]["create_time"] != "2020-01-02 03:04:05" {
+		t.Fatal(res)
+	}
+}
+
+func TestScanRowsMapTyped(t *testing.T) {
+	columns := []string{"price", "day", "created", "at", "year", "length", "big"}
+	types := []string{"DECIMAL", "DATE", "TIMESTAMP", "DATETIME", "YEAR", "TIME", "UNSIGNED BIGINT"}
+	utc := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := []driver.Value{[]byte("12.30"), []byte("2020-01-02"), utc, utc, int64(2020), []byte("01:02:03"), []byte("18446744073709551615")}
+
+	m := make(map[string]interface{})
+	if err := fakeScan(t, &m, columns, types, row); err != nil {
+		t.Fatal(err)
+	}
+	// defaults are unchanged except for the unsigned overflow
+	if m["price"] != 12.3 || m["day"] != "2020-01-02" || m["at"] != "2020-01-02 03:04:05" || m["big"] != uint64(18446744073709551615) {
+		t.Fatal(m)
+	}
+	// an unsigned BIGINT is an uint64 whatever its value, other unsigned integers stay int64
+	for _, src := range []driver.Value{int64(7), []byte("7")} {
+		m = make(map[string]interface{})
+		if err := fakeScan(t, &m, []string{"big", "n"}, []string{"UNSIGNED BIGINT", "UNSIGNED INT"}, []driver.Value{src, src}); err != nil {
+			t.Fatal(err)
+		}
+		if m["big"] != uint64(7) || m["n"] != int64(7) {
+			t.Fatalf("%T %T", m["big"], m["n"])
+		}
+	}
+
+	shanghai := time.FixedZone("CST", 8*3600)
+	opts := &queryOptions{decimal: DecimalRat, loc: shanghai}
+	TimeTypes("date", "timestamp", "year", "time")(opts)
+	m = make(map[string]interface{})
+	if err := fakeScanWith(t, &m, opts, columns, types, row); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := m["price"].(*big.Rat); !ok || r.FloatString(2) != "12.30" {
+		t.Fatal(m["price"])
+	}
+	if d, ok := m["day"].(time.Time); !ok || d.Location() != shanghai || d.Format("2006-01-02 15:04") != "2020-01-02 00:00" {
+		t.Fatal(m["day"])
+	}
+	if c, ok := m["created"].(time.Time); !ok || !c.Equal(utc) || c.Hour() != 11 {
+		t.Fatal(m["created"])
+	}
+	if m["at"] != "2020-01-02 11:04:05" {
+		t.Fatal(m["at"])
+	}
+	if y, ok := m["year"].(time.Time); !ok || y.Year() != 2020 {
+		t.Fatal(m["year"])
+	}
+	if m["length"] != time.Hour+2*time.Minute+3*time.Second {
+		t.Fatal(m["length"])
+	}
+
+	opts = &queryOptions{decimal: DecimalString}
+	m = make(map[string]interface{})
+	if err := fakeScanWith(t, &m, opts, columns, types, row); err != nil || m["price"] != "12.30" {
+		t.Fatal(m, err)
+	}
+	opts = &queryOptions{decimalParser: func(s string) (interface{}, error) { return "d" + s, nil }}
+	m = make(map[string]interface{})
+	if err := fakeScanWith(t, &m, opts, columns, types, row); err != nil || m["price"] != "d12.30" {
+		t.Fatal(m, err)
+	}
+}
+
+type nullable struct {
+	Name    *string        `orm:"name"`
+	Age     *int           `orm:"age"`
+	Score   int            `orm:"score"`
+	Remark  sql.NullString `orm:"remark"`
+	Updated sql.NullTime   `orm:"updated"`
+	Level   string         `orm:"level" default:"normal"`
+	Title   string         `orm:"title" default:"none"`
+}
+
+func TestScanRowsNull(t *testing.T) {
+	columns := []string{"name", "age", "score", "remark", "updated", "level", "title"}
+	types := []string{"VARCHAR", "INT", "INT", "VARCHAR", "DATETIME", "VARCHAR", "VARCHAR"}
+	now := time.Now()
+	res := make([]nullable, 0)
+	err := fakeScan(t, &res, columns, types,
+		[]driver.Value{nil, nil, nil, nil, nil, nil, []byte("")},
+		[]driver.Value{[]byte("tom"), []byte("18"), int64(3), []byte("hi"), now, []byte("vip"), []byte("x")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := res[0]
+	if n.Name != nil || n.Age != nil || n.Score != 0 || n.Remark.Valid || n.Updated.Valid || n.Level != "normal" || n.Title != "" {
+		t.Fatal(n)
+	}
+	n = res[1]
+	if *n.Name != "tom" || *n.Age != 18 || n.Score != 3 || n.Remark.String != "hi" || !n.Updated.Time.Equal(now) || n.Level != "vip" {
+		t.Fatal(n)
+	}
+
+	m := make(map[string]interface{})
+	if err := fakeScan(t, &m, columns, types, []driver.Value{nil, nil, nil, nil, nil, nil, []byte("")}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m["age"]; !ok || v != nil || m["title"] != "" {
+		t.Fatal(m)
+	}
+}
+
+func TestStructPlanCached(t *testing.T) {
+	typ := reflect.TypeOf(Token{})
+	if getStructPlan(typ, tokenColumns, SnakeCase) != getStructPlan(typ, tokenColumns, SnakeCase) {
+		t.Fatal("plan not cached")
+	}
+	if getStructPlan(typ, tokenColumns, SnakeCase) == getStructPlan(typ, tokenColumns[:3], SnakeCase) {
+		t.Fatal("plan shared across column sets")
+	}
+}
+
+const benchRows = 10000
+
+func benchResult(b *testing.B) [][]driver.Value {
+	rows := make([][]driver.Value, benchRows)
+	for i := range rows {
+		rows[i] = tokenRow(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return rows
+}
+
+// BenchmarkMapStringScan is the map[string]string round trip Query used before the cached plans
+func BenchmarkMapStringScan(b *testing.B) {
+	rows := benchResult(b)
+	for n := 0; n < b.N; n++ {
+		res := fakeQuery(b, tokenColumns, tokenTypes, rows...)
+		mapScan := NewMapStringScan(tokenColumns)
+		out := make([]benchToken, benchRows)
+		i := 0
+		for res.Next() {
+			if err := mapScan.Update(res); err != nil {
+				b.Fatal(err)
+			}
+			if err := mapScan.Unmarshal(reflect.ValueOf(&out[i])); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+		_ = res.Close()
+	}
+}
+
+func BenchmarkStructScanner(b *testing.B) {
+	rows := benchResult(b)
+	for n := 0; n < b.N; n++ {
+		res := fakeQuery(b, tokenColumns, tokenTypes, rows...)
+		out := make([]benchToken, 0, benchRows)
+		if err := scanRows(res, reflect.ValueOf(&out), &queryOptions{}); err != nil {
+			b.Fatal(err)
+		}
+		_ = res.Close()
+	}
+}
+
+type profile struct {
+	ID    int64             `orm:"id,pk"`
+	Tags  []string          `orm:"tags,json"`
+	Extra map[string]string `orm:"extra,json"`
+	Addr  *struct {
+		City string `json:"city"`
+	} `orm:"addr,json"`
+}
+
+func TestScanRowsJSON(t *testing.T) {
+	columns := []string{"id", "tags", "extra", "addr"}
+	types := []string{"BIGINT", "JSON", "JSON", "JSON"}
+	row := []driver.Value{int64(1), []byte(`["a","b"]`), nil, []byte(`{"city":"jinan"}`)}
+	p := profile{}
+	if err := fakeScan(t, &p, columns, types, row); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Tags) != 2 || p.Extra != nil || p.Addr == nil || p.Addr.City != "jinan" {
+		t.Fatal(p)
+	}
+
+	m := make(map[string]interface{})
+	if err := fakeScan(t, &m, columns, types, row); err != nil {
+		t.Fatal(err)
+	}
+	if addr, ok := m["addr"].(map[string]interface{}); !ok || addr["city"] != "jinan" || m["extra"] != nil {
+		t.Fatal(m)
+	}
+
+	v := reflect.ValueOf(&p).Elem()
+	_, args, err := buildUpdate("profile", v, typeFields(v.Type()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0] != `["a","b"]` || args[1] != nil || args[2] != `{"city":"jinan"}` {
+		t.Fatal(args)
+	}
+}
+
+type BaseModel struct {
+	ID         int64     `orm:"id,pk,autoincrement"`
+	CreateTime time.Time `orm:"create_time"`
+}
+
+type Audit struct {
+	Operator string `orm:"operator"`
+}
+
+type item struct {
+	ID   int64  `orm:"id"`
+	Name string `orm:"name"`
+}
+
+type order struct {
+	BaseModel
+	*Audit
+	No    string `orm:"no"`
+	Item  item   `prefix:"item_"`
+	Extra *item  `prefix:"extra_"`
+}
+
+func TestScanRowsNested(t *testing.T) {
+	columns := []string{"id", "create_time", "operator", "no", "item_id", "item_name", "extra_id", "extra_name"}
+	types := []string{"BIGINT", "DATETIME", "VARCHAR", "VARCHAR", "BIGINT", "VARCHAR", "BIGINT", "VARCHAR"}
+	now := time.Now()
+	res := make([]order, 0)
+	err := fakeScan(t, &res, columns, types,
+		[]driver.Value{int64(1), now, []byte("tom"), []byte("n1"), int64(10), []byte("apple"), nil, nil},
+		[]driver.Value{int64(2), now, nil, []byte("n2"), int64(11), []byte("pear"), int64(12), []byte("plum")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := res[0]
+	if o.ID != 1 || !o.CreateTime.Equal(now) || o.Audit == nil || o.Operator != "tom" || o.No != "n1" || o.Item.ID != 10 || o.Item.Name != "apple" || o.Extra != nil {
+		t.Fatal(o)
+	}
+	o = res[1]
+	if o.ID != 2 || o.Audit != nil || o.Extra == nil || o.Extra.Name != "plum" {
+		t.Fatal(o)
+	}
+
+	v := reflect.ValueOf(&o).Elem()
+	s, _, err := buildUpdate("order", v, typeFields(v.Type()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "update `order` set `create_time` = ?,`no` = ?,`item_id` = ?,`item_name` = ?,`extra_id` = ?,`extra_name` = ? where `id` = ?" {
+		t.Fatal(s)
+	}
+}
+
+func TestScanRowsScalar(t *testing.T) {
+	var count int64
+	if err := fakeScan(t, &count, []string{"count(*)"}, []string{"BIGINT"}, []driver.Value{int64(42)}); err != nil || count != 42 {
+		t.Fatal(count, err)
+	}
+	var name *string
+	if err := fakeScan(t, &name, []string{"name"}, []string{"VARCHAR"}, []driver.Value{nil}); err != nil || name != nil {
+		t.Fatal(name, err)
+	}
+	if err := fakeScan(t, &count, []string{"id", "name"}, []string{"BIGINT", "VARCHAR"}, []driver.Value{int64(1), nil}); err == nil {
+		t.Fatal("expected column count error")
+	}
+
+	ids := make([]int64, 0)
+	if err := fakeScan(t, &ids, []string{"id"}, []string{"BIGINT"}, []driver.Value{int64(1)}, []driver.Value{[]byte("2")}); err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Fatal(ids, err)
+	}
+	names := make([]*string, 0)
+	if err := fakeScan(t, &names, []string{"name"}, []string{"VARCHAR"}, []driver.Value{[]byte("a")}, []driver.Value{nil}); err != nil || len(names) != 2 || *names[0] != "a" || names[1] != nil {
+		t.Fatal(names, err)
+	}
+	var raw []byte
+	if err := fakeScan(t, &raw, []string{"data"}, []string{"BLOB"}, []driver.Value{[]byte("abc")}); err != nil || string(raw) != "abc" {
+		t.Fatal(raw, err)
+	}
+}
+
+func TestScanRowsPointersAndKeyed(t *testing.T) {
+	res := make([]*benchToken, 0)
+	if err := fakeScan(t, &res, tokenColumns, tokenTypes, tokenRow(1), tokenRow(2)); err != nil || len(res) != 2 || res[1].TokenID != "token2" {
+		t.Fatal(res, err)
+	}
+
+	byID := make(map[string]*benchToken)
+	res2 := fakeQuery(t, tokenColumns, tokenTypes, tokenRow(1), tokenRow(2))
+	defer res2.Close()
+	if err := scanRows(res2, reflect.ValueOf(&byID), &queryOptions{keyBy: "token_id"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(byID) != 2 || byID["token1"].Type != 1 || byID["token2"].TokenID != "token2" {
+		t.Fatal(byID)
+	}
+
+	var byType map[int]string
+	res3 := fakeQuery(t, []string{"type"}, []string{"INT"}, []driver.Value{int64(3)})
+	defer res3.Close()
+	if err := scanRows(res3, reflect.ValueOf(&byType), &queryOptions{keyBy: "type"}); err != nil || byType[3] != "3" {
+		t.Fatal(byType, err)
+	}
+}
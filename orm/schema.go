@@ -0,0 +1,124 @@
+package orm
+
+import (
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"sort"
+	"strings"
+)
+
+// ColumnSchema is a column as described by information_schema.COLUMNS
+type ColumnSchema struct {
+	Table    string  `orm:"table_name"`
+	Name     string  `orm:"column_name"`
+	Position int     `orm:"ordinal_position"`
+	Default  *string `orm:"column_default"`
+	Nullable bool    `orm:"nullable"`
+	DataType string  `orm:"data_type"`
+	// ColumnType is the full type, e.g. "bigint(20) unsigned" or "varchar(64)"
+	ColumnType string `orm:"column_type"`
+	// Key is PRI, UNI, MUL or empty
+	Key     string `orm:"column_key"`
+	Extra   string `orm:"extra"`
+	Comment string `orm:"column_comment"`
+}
+
+// IndexSchema is an index as described by information_schema.STATISTICS, PRIMARY included
+type IndexSchema struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+// TableSchema is a table with its columns in ordinal order
+type TableSchema struct {
+	Name    string          `orm:"table_name"`
+	Comment string          `orm:"table_comment"`
+	Columns []*ColumnSchema `orm:"-"`
+	Indexes []*IndexSchema  `orm:"-"`
+}
+
+// indexColumn is one row of information_schema.STATISTICS
+type indexColumn struct {
+	Table     string `orm:"table_name"`
+	Index     string `orm:"index_name"`
+	NonUnique bool   `orm:"non_unique"`
+	Column    string `orm:"column_name"`
+}
+
+func (c *ColumnSchema) IsPrimaryKey() bool {
+	return c.Key == "PRI"
+}
+
+func (c *ColumnSchema) IsAutoIncrement() bool {
+	return strings.Contains(strings.ToLower(c.Extra), "auto_increment")
+}
+
+func (c *ColumnSchema) IsUnsigned() bool {
+	return strings.Contains(strings.ToLower(c.ColumnType), "unsigned")
+}
+
+// inClause returns " and column in (?,?)" with its args, empty for no values
+func inClause(column string, values []string) (string, []interface{}) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return " and " + column + " in (" + placeholders(len(values)) + ")", args
+}
+
+// LoadSchema reads the tables of db.DBName with their columns and indexes from information_schema, all of them when tables is empty.
+// Tables are sorted by name so that the output of generators is stable.
+func LoadSchema(db *mysql.DBConfig, tables ...string) ([]*TableSchema, error) {
+	cond, args := inClause("TABLE_NAME", tables)
+	args = append([]interface{}{db.DBName}, args...)
+
+	res := make([]*TableSchema, 0)
+	err := Query(db, "select TABLE_NAME as table_name, TABLE_COMMENT as table_comment from information_schema.TABLES "+
+		"where TABLE_SCHEMA = ?"+cond+" order by TABLE_NAME", &res, args...)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]*ColumnSchema, 0)
+	err = Query(db, "select TABLE_NAME as table_name, COLUMN_NAME as column_name, ORDINAL_POSITION as ordinal_position, "+
+		"COLUMN_DEFAULT as column_default, IS_NULLABLE = 'YES' as nullable, DATA_TYPE as data_type, "+
+		"COLUMN_TYPE as column_type, COLUMN_KEY as column_key, EXTRA as extra, COLUMN_COMMENT as column_comment "+
+		"from information_schema.COLUMNS where TABLE_SCHEMA = ?"+cond+" order by TABLE_NAME, ORDINAL_POSITION", &columns, args...)
+	if err != nil && err != mysql.ErrorNotFound {
+		return nil, err
+	}
+	byName := make(map[string]*TableSchema, len(res))
+	for _, t := range res {
+		byName[t.Name] = t
+	}
+	for _, c := range columns {
+		if t, ok := byName[c.Table]; ok {
+			t.Columns = append(t.Columns, c)
+		}
+	}
+	indexes := make([]*indexColumn, 0)
+	err = Query(db, "select TABLE_NAME as table_name, INDEX_NAME as index_name, NON_UNIQUE as non_unique, COLUMN_NAME as column_name "+
+		"from information_schema.STATISTICS where TABLE_SCHEMA = ?"+cond+" order by TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX", &indexes, args...)
+	if err != nil && err != mysql.ErrorNotFound {
+		return nil, err
+	}
+	for _, ic := range indexes {
+		t, ok := byName[ic.Table]
+		if !ok {
+			continue
+		}
+		if n := len(t.Indexes); n > 0 && t.Indexes[n-1].Name == ic.Index {
+			t.Indexes[n-1].Columns = append(t.Indexes[n-1].Columns, ic.Column)
+			continue
+		}
+		t.Indexes = append(t.Indexes, &IndexSchema{Name: ic.Index, Unique: !ic.NonUnique, Columns: []string{ic.Column}})
+	}
+	for _, t := range res {
+		sort.SliceStable(t.Columns, func(i, j int) bool {
+			return t.Columns[i].Position < t.Columns[j].Position
+		})
+	}
+	return res, nil
+}
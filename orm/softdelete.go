@@ -0,0 +1,142 @@
+package orm
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"reflect"
+	"time"
+)
+
+// ErrorNoSoftDelete is returned by Restore for a struct without orm:"name,softdelete" field
+var ErrorNoSoftDelete = errors.New("no soft delete field, tag one with orm:\"name,softdelete\"")
+
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+type deletedScope int
+
+const (
+	scopeAlive deletedScope = iota
+	scopeWithDeleted
+	scopeOnlyDeleted
+)
+
+// softDeleteField returns the field tagged softdelete, nil when there is none.
+// It must be a *time.Time or sql.NullTime (NULL while alive) or an integer holding unix seconds (0 while alive).
+func softDeleteField(fields []*field) (*field, error) {
+	for _, f := range fields {
+		if !f.softDelete {
+			continue
+		}
+		switch {
+		case f.typ == nullTimeType, f.typ.Kind() == reflect.Ptr && f.typ.Elem() == timeType:
+		case isNumberKind(f.typ.Kind()) && f.typ.Kind() != reflect.Float32 && f.typ.Kind() != reflect.Float64:
+		default:
+			return nil, errors.New("softdelete field must be *time.Time, sql.NullTime or an integer:" + f.fieldName)
+		}
+		return f, nil
+	}
+	return nil, nil
+}
+
+// scopeClause returns the condition selecting the rows of scope, empty when every row is selected
+func scopeClause(f *field, scope deletedScope) string {
+	if f == nil || scope == scopeWithDeleted {
+		return ""
+	}
+	numeric := isNumberKind(f.typ.Kind())
+	switch {
+	case scope == scopeOnlyDeleted && numeric:
+		return quote(f.name) + " <> 0"
+	case scope == scopeOnlyDeleted:
+		return quote(f.name) + " is not null"
+	case numeric:
+		return quote(f.name) + " = 0"
+	}
+	return quote(f.name) + " is null"
+}
+
+// softDeleteScope returns the soft delete condition of queries on struct type t
+func softDeleteScope(t reflect.Type, opts *queryOptions) (string, error) {
+	f, err := softDeleteField(namedFields(t, opts.namingStrategy()))
+	if err != nil {
+		return "", err
+	}
+	return scopeClause(f, opts.deleted), nil
+}
+
+// deletedValue returns the value marking a row deleted at now, a zero now restores it
+func deletedValue(f *field, now time.Time) interface{} {
+	switch {
+	case isNumberKind(f.typ.Kind()):
+		if now.IsZero() {
+			return int64(0)
+		}
+		return now.Unix()
+	case now.IsZero():
+		return nil
+	}
+	return now
+}
+
+// setDeleted stores the deletedValue of now into fv
+func setDeleted(f *field, fv reflect.Value, now time.Time) {
+	switch {
+	case f.typ == nullTimeType:
+		fv.Set(reflect.ValueOf(sql.NullTime{Time: now, Valid: !now.IsZero()}))
+	case f.typ.Kind() == reflect.Ptr:
+		if now.IsZero() {
+			fv.Set(reflect.Zero(f.typ))
+		} else {
+			fv.Set(reflect.ValueOf(&now))
+		}
+	case now.IsZero():
+		fv.Set(reflect.Zero(f.typ))
+	case fv.Kind() >= reflect.Int && fv.Kind() <= reflect.Int64:
+		fv.SetInt(now.Unix())
+	default:
+		fv.SetUint(uint64(now.Unix()))
+	}
+}
+
+// buildSoftDelete builds the update marking the row deleted, or restoring it when now is zero
+func buildSoftDelete(table string, v reflect.Value, fields []*field, sd *field, now time.Time) (string, []interface{}, error) {
+	pks, err := primaryKeys(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	where, args := whereClause(v, pks)
+	scope := scopeAlive
+	if now.IsZero() {
+		scope = scopeOnlyDeleted
+	}
+	s := "update " + quote(table) + " set " + quote(sd.name) + " = ? where " + where + " and " + scopeClause(sd, scope)
+	return s, append([]interface{}{deletedValue(sd, now)}, args...), nil
+}
+
+// Restore clears the soft delete mark of the row of table matching the pk fields of the struct pointed by ptr
+func Restore(db *mysql.DBConfig, table string, ptr interface{}) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	fields := typeFields(v.Type())
+	sd, err := softDeleteField(fields)
+	if err != nil {
+		return err
+	}
+	if sd == nil {
+		return ErrorNoSoftDelete
+	}
+	s, args, err := buildSoftDelete(table, v, fields, sd, time.Time{})
+	if err != nil {
+		return err
+	}
+	if err = mysql.Update(db, s, nil, args...); err != nil {
+		return err
+	}
+	if fv, ok := fieldByIndex(v, sd.index); ok {
+		setDeleted(sd, fv, time.Time{})
+	}
+	return nil
+}
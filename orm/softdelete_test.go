@@ -0,0 +1,159 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type softOrder struct {
+	ID        int64      `orm:"id,pk"`
+	UserID    int64      `orm:"user_id"`
+	No        string     `orm:"no"`
+	DeletedAt *time.Time `orm:"deleted_at,softdelete"`
+}
+
+type softUser struct {
+	ID      int64        `orm:"id,pk"`
+	Deleted int64        `orm:"deleted,softdelete"`
+	Orders  []*softOrder `rel:"hasmany;table=orders;fk=user_id;ref=id"`
+}
+
+func TestSoftDeleteSQL(t *testing.T) {
+	o := &softOrder{ID: 3}
+	v := reflect.ValueOf(o).Elem()
+	fields := typeFields(v.Type())
+	sd, err := softDeleteField(fields)
+	if err != nil || sd == nil {
+		t.Fatal(sd, err)
+	}
+	now := time.Now()
+	s, args, err := buildSoftDelete("orders", v, fields, sd, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "update `orders` set `deleted_at` = ? where `id` = ? and `deleted_at` is null" || args[0] != now || args[1] != int64(3) {
+		t.Fatal(s, args)
+	}
+	s, args, _ = buildSoftDelete("orders", v, fields, sd, time.Time{})
+	if s != "update `orders` set `deleted_at` = ? where `id` = ? and `deleted_at` is not null" || args[0] != nil {
+		t.Fatal(s, args)
+	}
+	setDeleted(sd, v.Field(3), now)
+	if o.DeletedAt == nil || !o.DeletedAt.Equal(now) {
+		t.Fatal(o.DeletedAt)
+	}
+	setDeleted(sd, v.Field(3), time.Time{})
+	if o.DeletedAt != nil {
+		t.Fatal(o.DeletedAt)
+	}
+
+	u := &softUser{ID: 1}
+	uv := reflect.ValueOf(u).Elem()
+	ufields := typeFields(uv.Type())
+	usd, _ := softDeleteField(ufields)
+	s, args, _ = buildSoftDelete("user", uv, ufields, usd, now)
+	if s != "update `user` set `deleted` = ? where `id` = ? and `deleted` = 0" || args[0] != now.Unix() {
+		t.Fatal(s, args)
+	}
+	setDeleted(usd, uv.Field(1), now)
+	if u.Deleted != now.Unix() {
+		t.Fatal(u.Deleted)
+	}
+	// restoring an integer field
+	s, args, _ = buildSoftDelete("user", uv, ufields, usd, time.Time{})
+	if s != "update `user` set `deleted` = ? where `id` = ? and `deleted` <> 0" || args[0] != int64(0) {
+		t.Fatal(s, args)
+	}
+	setDeleted(usd, uv.Field(1), time.Time{})
+	if u.Deleted != 0 {
+		t.Fatal(u.Deleted)
+	}
+	type uintDeleted struct {
+		ID      int64  `orm:"id,pk"`
+		Deleted uint32 `orm:"deleted,softdelete"`
+	}
+	ud := &uintDeleted{ID: 1}
+	udv := reflect.ValueOf(ud).Elem()
+	uisd, _ := softDeleteField(typeFields(udv.Type()))
+	setDeleted(uisd, udv.Field(1), now)
+	if ud.Deleted != uint32(now.Unix()) {
+		t.Fatal(ud.Deleted)
+	}
+	setDeleted(uisd, udv.Field(1), time.Time{})
+	if ud.Deleted != 0 {
+		t.Fatal(ud.Deleted)
+	}
+
+	type bad struct {
+		DeletedAt time.Time `orm:"deleted_at,softdelete"`
+	}
+	if _, err := softDeleteField(typeFields(reflect.TypeOf(bad{}))); err == nil {
+		t.Fatal("expected error for time.Time")
+	}
+}
+
+func TestSoftDeleteUpdate(t *testing.T) {
+	// loaded before it was deleted, or WithDeleted
+	deleted := time.Now()
+	o := &softOrder{ID: 3, UserID: 1, No: "a", DeletedAt: &deleted}
+	v := reflect.ValueOf(o).Elem()
+	s, args, err := buildUpdate("orders", v, typeFields(v.Type()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "update `orders` set `user_id` = ?,`no` = ? where `id` = ? and `deleted_at` is null" || len(args) != 3 {
+		t.Fatal(s, args)
+	}
+	o.DeletedAt = nil
+	if s, _, _ = buildUpdate("orders", v, typeFields(v.Type()), nil); strings.Contains(s, "`deleted_at` = ?") {
+		t.Fatal("update revives the row", s)
+	}
+	s, args, _ = buildUpdate("orders", v, typeFields(v.Type()), []string{"deleted_at"})
+	if s != "update `orders` set `deleted_at` = ? where `id` = ?" || len(args) != 2 {
+		t.Fatal(s, args)
+	}
+}
+
+func TestFindSQL(t *testing.T) {
+	typ := reflect.TypeOf(softOrder{})
+	cases := []struct {
+		where string
+		opts  *queryOptions
+		want  string
+	}{
+		{"", &queryOptions{}, "select * from `orders` where `deleted_at` is null"},
+		{"no = ? or id = ?", &queryOptions{}, "select * from `orders` where (no = ? or id = ?) and `deleted_at` is null"},
+		{"no = ?", &queryOptions{deleted: scopeWithDeleted}, "select * from `orders` where no = ?"},
+		{"", &queryOptions{deleted: scopeOnlyDeleted}, "select * from `orders` where `deleted_at` is not null"},
+	}
+	for _, c := range cases {
+		if s, err := findSQL("orders", typ, c.where, c.opts); err != nil || s != c.want {
+			t.Fatal(s, err)
+		}
+	}
+	if s, _ := findSQL("account", reflect.TypeOf(Account{}), "", &queryOptions{}); s != "select * from `account`" {
+		t.Fatal(s)
+	}
+}
+
+func TestPreloadSoftDeleted(t *testing.T) {
+	ran := make([]string, 0)
+	result := &fakeResult{columns: []string{"id", "user_id"}, types: []string{"BIGINT", "BIGINT"}, rows: [][]driver.Value{{int64(7), int64(1)}}}
+	q := fakeQueryFunc(t, map[string]*fakeResult{
+		"select * from `orders` where `user_id` in (?) and `deleted_at` is null": result,
+		"select * from `orders` where `user_id` in (?)":                          result,
+	}, &ran)
+	users := []softUser{{ID: 1}}
+	if err := preload(q, reflect.ValueOf(&users), &queryOptions{preload: []string{"Orders"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := preload(q, reflect.ValueOf(&users), &queryOptions{preload: []string{"Orders"}, deleted: scopeWithDeleted}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || len(users[0].Orders) != 1 {
+		t.Fatal(ran, users[0].Orders)
+	}
+}
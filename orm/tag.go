@@ -0,0 +1,213 @@
+package orm
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	optPK            = "pk"
+	optAutoIncrement = "autoincrement"
+	optOmitEmpty     = "omitempty"
+	optJSON          = "json"
+	optSoftDelete    = "softdelete"
+	optEncrypt       = "encrypt"
+)
+
+// tagOptions is the string following a comma in an orm tag, e.g. `orm:"id,pk,autoincrement"`
+type tagOptions string
+
+func parseTag(tag string) (string, tagOptions) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tagOptions(tag[idx+1:])
+	}
+	return tag, ""
+}
+
+func (o tagOptions) Contains(optionName string) bool {
+	if len(o) == 0 {
+		return false
+	}
+	s := string(o)
+	for s != "" {
+		var next string
+		i := strings.Index(s, ",")
+		if i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if strings.TrimSpace(s) == optionName {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// field describes a struct field mapped to a table column
+type field struct {
+	index         []int
+	name          string
+	fieldName     string
+	typ           reflect.Type
+	tag           reflect.StructTag
+	pk            bool
+	autoIncrement bool
+	omitEmpty     bool
+	json          bool
+	softDelete    bool
+	encrypt       bool
+	// blind is the blind index column of an encrypted field, from the blind tag
+	blind string
+}
+
+// typeFields returns the column mapped fields of struct type t named with the global strategy
+func typeFields(t reflect.Type) []*field {
+	return namedFields(t, currentNaming())
+}
+
+// namedFields returns the column mapped fields of struct type t, untagged fields are named by n.
+// Anonymous struct fields are flattened, named struct fields with a prefix tag are
+// flattened with their column names prefixed, e.g. `prefix:"item_"`.
+// A field of the outer struct hides a field of an embedded one mapped to the same column.
+func namedFields(t reflect.Type, n NamingStrategy) []*field {
+	fields := walkFields(t, nil, "", n, map[reflect.Type]bool{t: true})
+	// keep the shallowest field of each column, like Go field promotion
+	depth := make(map[string]int, len(fields))
+	for _, f := range fields {
+		if d, ok := depth[f.name]; !ok || len(f.index) < d {
+			depth[f.name] = len(f.index)
+		}
+	}
+	res := fields[:0]
+	for _, f := range fields {
+		if d, ok := depth[f.name]; ok && d == len(f.index) {
+			res = append(res, f)
+			delete(depth, f.name)
+		}
+	}
+	return res
+}
+
+func walkFields(t reflect.Type, parent []int, prefix string, n NamingStrategy, visiting map[reflect.Type]bool) []*field {
+	fields := make([]*field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("orm")
+		if tag == "-" {
+			continue
+		}
+		if _, ok := sf.Tag.Lookup("rel"); ok {
+			// relations are loaded by Preload
+			continue
+		}
+		name, opts := parseTag(tag)
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		nestedPrefix, hasPrefix := sf.Tag.Lookup("prefix")
+		nested := ft.Kind() == reflect.Struct && !isValueType(ft) && !opts.Contains(optJSON) &&
+			((sf.Anonymous && name == "") || hasPrefix)
+		if nested {
+			if sf.PkgPath != "" && sf.Type.Kind() == reflect.Ptr {
+				// unexported pointer can't be allocated
+				continue
+			}
+			if visiting[ft] {
+				continue
+			}
+			visiting[ft] = true
+			fields = append(fields, walkFields(ft, index, prefix+nestedPrefix, n, visiting)...)
+			delete(visiting, ft)
+			continue
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = n.ColumnName(sf)
+		}
+		fields = append(fields, &field{
+			index:         index,
+			name:          prefix + name,
+			fieldName:     sf.Name,
+			typ:           sf.Type,
+			tag:           sf.Tag,
+			pk:            opts.Contains(optPK),
+			autoIncrement: opts.Contains(optAutoIncrement),
+			omitEmpty:     opts.Contains(optOmitEmpty),
+			json:          opts.Contains(optJSON),
+			softDelete:    opts.Contains(optSoftDelete),
+			encrypt:       opts.Contains(optEncrypt),
+			blind:         sf.Tag.Get("blind"),
+		})
+	}
+	return fields
+}
+
+// isValueType reports whether struct type t is decoded from a single column rather than flattened
+func isValueType(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	if _, ok := lookupConverter(t); ok {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	return pt.Implements(scannerType) || pt.Implements(textUnmarshalerType)
+}
+
+// fieldByIndex returns the field of v at index, ok is false when the path goes through a nil pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc is fieldByIndex allocating the nil pointers on the path
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if t, ok := v.Interface().(interface{ IsZero() bool }); ok {
+			return t.IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is a custom rule registered with RegisterValidator, param is the text after "=" in the tag
+type Validator func(value interface{}, param string) error
+
+var (
+	validators   = make(map[string]Validator)
+	validatorsMu sync.RWMutex
+	rulesCache   sync.Map // map[rulesKey]*typeRules
+
+	emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	// mainland China mobile number, optionally prefixed with the country code
+	phoneRegexp = regexp.MustCompile(`^(\+?86)?1[3-9]\d{9}$`)
+)
+
+// RegisterValidator adds a named rule usable in valid tags, e.g. valid:"idCard" or valid:"prefix=ab".
+// Call it at startup before the types using it are queried or written.
+func RegisterValidator(name string, v Validator) {
+	validatorsMu.Lock()
+	if v == nil {
+		delete(validators, name)
+	} else {
+		validators[name] = v
+	}
+	validatorsMu.Unlock()
+	rulesCache.Range(func(key, value interface{}) bool {
+		rulesCache.Delete(key)
+		return true
+	})
+	// cached plans hold the rules parsed before
+	planCache.Range(func(key, value interface{}) bool {
+		planCache.Delete(key)
+		return true
+	})
+}
+
+// rule is one parsed entry of a valid tag
+type rule struct {
+	text  string
+	check func(v reflect.Value) error
+}
+
+type fieldRules struct {
+	index     []int
+	fieldName string
+	column    string
+	notEmpty  bool
+	rules     []rule
+}
+
+type typeRules struct {
+	fields []*fieldRules
+	err    error
+}
+
+type rulesKey struct {
+	typ    reflect.Type
+	naming NamingStrategy
+}
+
+func getTypeRules(t reflect.Type, n NamingStrategy) *typeRules {
+	key := rulesKey{typ: t, naming: n}
+	if r, ok := rulesCache.Load(key); ok {
+		return r.(*typeRules)
+	}
+	r, _ := rulesCache.LoadOrStore(key, newTypeRules(t, n))
+	return r.(*typeRules)
+}
+
+// validTag is a parsed valid tag, rules are separated by ";":
+//
+//	valid:"notEmpty;len=2:20;regex=^[a-z]+$"
+//
+// The legacy comma separated form, e.g. valid:"notEmpty,xxx", only ever meant notEmpty
+// and is still read that way, its other entries are ignored as before.
+type validTag struct {
+	notEmpty bool
+	rules    []string
+}
+
+func parseValidTag(tag string) validTag {
+	var vt validTag
+	for _, text := range strings.Split(tag, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if text == NotEmpty {
+			vt.notEmpty = true
+			continue
+		}
+		if i := strings.Index(text, ","); i != -1 && strings.TrimSpace(text[:i]) == NotEmpty {
+			vt.notEmpty = true
+			continue
+		}
+		vt.rules = append(vt.rules, text)
+	}
+	return vt
+}
+
+// newTypeRules parses the valid tags of t
+func newTypeRules(t reflect.Type, n NamingStrategy) *typeRules {
+	tr := &typeRules{}
+	for _, f := range namedFields(t, n) {
+		tag := f.tag.Get("valid")
+		if tag == "" {
+			continue
+		}
+		vt := parseValidTag(tag)
+		fr := &fieldRules{index: f.index, fieldName: f.fieldName, column: f.name, notEmpty: vt.notEmpty}
+		for _, text := range vt.rules {
+			r, err := parseRule(text, f.typ)
+			if err != nil {
+				tr.err = errors.New(f.fieldName + ": " + err.Error())
+				return tr
+			}
+			fr.rules = append(fr.rules, r)
+		}
+		tr.fields = append(tr.fields, fr)
+	}
+	return tr
+}
+
+func parseRule(text string, t reflect.Type) (rule, error) {
+	name, param := text, ""
+	if i := strings.Index(text, "="); i != -1 {
+		name, param = text[:i], text[i+1:]
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	r := rule{text: text}
+	switch name {
+	case "min", "max":
+		if !isNumberKind(t.Kind()) {
+			return r, errors.New(name + " applies to numbers, use len for " + t.String())
+		}
+		bound, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return r, errors.New("bad " + text)
+		}
+		isMin := name == "min"
+		r.check = func(v reflect.Value) error {
+			n := numberOf(v)
+			if isMin && n < bound {
+				return errors.New("less than " + param)
+			}
+			if !isMin && n > bound {
+				return errors.New("greater than " + param)
+			}
+			return nil
+		}
+	case "len":
+		switch t.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		default:
+			return r, errors.New("len applies to strings, slices and maps, not " + t.String())
+		}
+		lo, hi, err := parseRange(param)
+		if err != nil {
+			return r, errors.New("bad " + text)
+		}
+		r.check = func(v reflect.Value) error {
+			n := v.Len()
+			if v.Kind() == reflect.String {
+				n = utf8.RuneCountInString(v.String())
+			}
+			if n < lo || (hi >= 0 && n > hi) {
+				return errors.New("length " + strconv.Itoa(n) + " out of " + param)
+			}
+			return nil
+		}
+	case "regex", "email", "phone":
+		if t.Kind() != reflect.String {
+			return r, errors.New(name + " applies to strings, not " + t.String())
+		}
+		re := emailRegexp
+		switch name {
+		case "phone":
+			re = phoneRegexp
+		case "regex":
+			var err error
+			if re, err = regexp.Compile(param); err != nil {
+				return r, err
+			}
+		}
+		r.check = func(v reflect.Value) error {
+			if !re.MatchString(v.String()) {
+				return errors.New("not a valid " + name)
+			}
+			return nil
+		}
+	case "oneof":
+		allowed := strings.Fields(param)
+		r.check = func(v reflect.Value) error {
+			s := fmt.Sprint(v.Interface())
+			for _, a := range allowed {
+				if s == a {
+					return nil
+				}
+			}
+			return errors.New("not one of " + param)
+		}
+	default:
+		validatorsMu.RLock()
+		custom, ok := validators[name]
+		validatorsMu.RUnlock()
+		if !ok {
+			return r, errors.New("unknown validator " + name)
+		}
+		r.check = func(v reflect.Value) error {
+			return custom(v.Interface(), param)
+		}
+	}
+	return r, nil
+}
+
+// parseRange parses "n", "lo:hi", "lo:" or ":hi", hi is -1 when open
+func parseRange(s string) (int, int, error) {
+	i := strings.Index(s, ":")
+	if i == -1 {
+		n, err := strconv.Atoi(s)
+		return n, n, err
+	}
+	lo, hi := 0, -1
+	var err error
+	if s[:i] != "" {
+		if lo, err = strconv.Atoi(s[:i]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if s[i+1:] != "" {
+		if hi, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return lo, hi, nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func numberOf(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// isBlank is the notEmpty check of a Go value, numbers and bools are never blank
+func isBlank(v reflect.Value) bool {
+	if isNumberKind(v.Kind()) || v.Kind() == reflect.Bool {
+		return false
+	}
+	return isEmptyValue(v)
+}
+
+// validate checks the struct v against the rules of tr and appends every violation to errs.
+// skipNotEmpty is set on reads where notEmpty was already checked on the column.
+// only, when not nil, restricts the check to the given columns.
+func (tr *typeRules) validate(v reflect.Value, row int, skipNotEmpty bool, only map[string]bool, errs *MultiFieldError) {
+	for _, fr := range tr.fields {
+		if only != nil && !only[fr.column] {
+			continue
+		}
+		fv, ok := fieldByIndex(v, fr.index)
+		if !ok {
+			continue
+		}
+		if fr.notEmpty && !skipNotEmpty && isBlank(fv) {
+			errs.add(&FieldError{Row: row, Column: fr.column, Field: fr.fieldName, Rule: NotEmpty, Reason: "empty"})
+			continue
+		}
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Ptr {
+			// nil is only checked by notEmpty
+			continue
+		}
+		for _, r := range fr.rules {
+			if err := r.check(fv); err != nil {
+				errs.add(&FieldError{Row: row, Column: fr.column, Field: fr.fieldName,
+					Value: fmt.Sprint(fv.Interface()), Rule: r.text, Reason: err.Error()})
+			}
+		}
+	}
+}
+
+// hasRules reports whether reads need a struct level check beyond the notEmpty column check
+func (tr *typeRules) hasRules() bool {
+	for _, fr := range tr.fields {
+		if len(fr.rules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the struct pointed by ptr against its valid tags and returns a *MultiFieldError
+// listing every violation with its field and rule.
+func Validate(ptr interface{}) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	return validateStruct(v, nil)
+}
+
+func validateStruct(v reflect.Value, only map[string]bool) error {
+	tr := getTypeRules(v.Type(), currentNaming())
+	if tr.err != nil {
+		return tr.err
+	}
+	errs := &MultiFieldError{}
+	tr.validate(v, -1, false, only, errs)
+	return errs.errOrNil()
+}
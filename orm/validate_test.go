@@ -0,0 +1,120 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type member struct {
+	ID     int64   `orm:"id,pk"`
+	Name   string  `orm:"name" valid:"notEmpty;len=2:4"`
+	Age    int     `orm:"age" valid:"min=0;max=150"`
+	Email  string  `orm:"email" valid:"email"`
+	Mobile *string `orm:"mobile" valid:"phone"`
+	Level  string  `orm:"level" valid:"oneof=low high"`
+	Code   string  `orm:"code" valid:"regex=^[A-Z]{2,3}$;upper"`
+}
+
+func init() {
+	RegisterValidator("upper", func(value interface{}, param string) error {
+		if s := value.(string); s != strings.ToUpper(s) {
+			return errors.New("not upper case")
+		}
+		return nil
+	})
+}
+
+func TestValidate(t *testing.T) {
+	mobile := "18653558566"
+	ok := &member{Name: "张三", Age: 20, Email: "a@b.cn", Mobile: &mobile, Level: "low", Code: "AB"}
+	if err := Validate(ok); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := "123"
+	m := &member{Name: "", Age: 200, Email: "nope", Mobile: &bad, Level: "mid", Code: "abcd"}
+	err := Validate(m)
+	multi, isMulti := err.(*MultiFieldError)
+	if !isMulti {
+		t.Fatal(err)
+	}
+	rules := make([]string, 0)
+	for _, e := range multi.Errors {
+		rules = append(rules, e.Field+":"+e.Rule)
+	}
+	if strings.Join(rules, ",") != "Name:notEmpty,Age:max=150,Email:email,Mobile:phone,Level:oneof=low high,Code:regex=^[A-Z]{2,3}$,Code:upper" {
+		t.Fatal(rules)
+	}
+
+	if err := validateStruct(reflect.ValueOf(m).Elem(), map[string]bool{"id": true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOnRead(t *testing.T) {
+	columns := []string{"id", "name", "age"}
+	types := []string{"BIGINT", "VARCHAR", "INT"}
+	res := make([]member, 0)
+	err := fakeScan(t, &res, columns, types, []driver.Value{int64(1), []byte("tom"), int64(-1)})
+	if multi, ok := err.(*MultiFieldError); !ok || len(multi.Errors) != 1 || multi.Errors[0].Rule != "min=0" || multi.Errors[0].Row != 0 {
+		t.Fatal(err)
+	}
+
+	// a single struct is checked the same way, lenient or not
+	var one member
+	// documented on Lenient: notEmpty fails a lenient single struct read instead of being logged
+	if err = fakeScanWith(t, &one, &queryOptions{strict: false}, columns, types, []driver.Value{int64(1), []byte(""), int64(3)}); err == nil {
+		t.Fatal("expected notEmpty error")
+	}
+	err = fakeScan(t, &one, columns, types, []driver.Value{int64(1), []byte("tom"), int64(-1)})
+	if multi, ok := err.(*MultiFieldError); !ok || len(multi.Errors) != 1 || multi.Errors[0].Rule != "min=0" {
+		t.Fatal(err)
+	}
+	err = fakeScanWith(t, &one, &queryOptions{strict: true}, columns, types, []driver.Value{int64(1), []byte("tom"), int64(-1)})
+	if _, ok := err.(*MultiFieldError); !ok {
+		t.Fatal(err)
+	}
+	if err = fakeScan(t, &one, columns, types, []driver.Value{int64(1), []byte("tom"), int64(3)}); err != nil || one.Age != 3 {
+		t.Fatal(one, err)
+	}
+}
+
+func TestLegacyValidTag(t *testing.T) {
+	type legacy struct {
+		ID   int64  `orm:"id"`
+		Name string `orm:"name" valid:"notEmpty,required"`
+		Nick string `orm:"nick" valid:"notEmpty "`
+	}
+	for _, tag := range []string{"notEmpty,required", "notEmpty ", " notEmpty ; len=1:3"} {
+		if vt := parseValidTag(tag); !vt.notEmpty {
+			t.Fatal(tag, vt)
+		}
+	}
+	if vt := parseValidTag("regex=^[A-Z]{2,3}$;notEmpty"); !vt.notEmpty || len(vt.rules) != 1 || vt.rules[0] != "regex=^[A-Z]{2,3}$" {
+		t.Fatal(vt)
+	}
+
+	columns, types := []string{"id", "name", "nick"}, []string{"BIGINT", "VARCHAR", "VARCHAR"}
+	var one legacy
+	if err := fakeScan(t, &one, columns, types, []driver.Value{int64(1), []byte("tom"), []byte("t")}); err != nil || one.Name != "tom" {
+		t.Fatal(one, err)
+	}
+	if err := fakeScan(t, &one, columns, types, []driver.Value{int64(1), []byte(""), []byte("t")}); err == nil {
+		t.Fatal("expected notEmpty error")
+	}
+	if err := Validate(&legacy{Name: "a", Nick: "b"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateBadTag(t *testing.T) {
+	type broken struct {
+		Name string `valid:"min=1"`
+	}
+	if err := Validate(&broken{}); err == nil {
+		t.Fatal("expected min on string error")
+	}
+}
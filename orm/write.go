@@ -0,0 +1,347 @@
+package orm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/yanzongzhen/DBOperation/mysql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorNoPrimaryKey = errors.New("no primary key field, tag one with orm:\"name,pk\"")
+	ErrorNoColumns    = errors.New("no columns to write")
+)
+
+func structValue(ptr interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return reflect.Value{}, errors.New("v must be pointer")
+	}
+	v := rv.Elem()
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, errors.New("un support type:" + v.Kind().String())
+	}
+	return v, nil
+}
+
+func quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
+}
+
+// columnValue returns the argument written for field f holding fv
+func columnValue(f *field, fv reflect.Value) (interface{}, error) {
+	if f.encrypt {
+		return encryptedValue(f, fv)
+	}
+	if !f.json {
+		return fv.Interface(), nil
+	}
+	return jsonValue(fv)
+}
+
+// jsonValue returns the JSON text of fv, nil for a nil pointer, map, slice or interface
+func jsonValue(fv reflect.Value) (interface{}, error) {
+	switch fv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if fv.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// primaryKeys returns the pk fields, error if the struct has none
+func primaryKeys(fields []*field) ([]*field, error) {
+	pks := make([]*field, 0, 1)
+	for _, f := range fields {
+		if f.pk {
+			pks = append(pks, f)
+		}
+	}
+	if len(pks) == 0 {
+		return nil, ErrorNoPrimaryKey
+	}
+	return pks, nil
+}
+
+// whereClause builds "`a` = ? and `b` = ?" for the given fields
+func whereClause(v reflect.Value, fields []*field) (string, []interface{}) {
+	conds := make([]string, 0, len(fields))
+	args := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		conds = append(conds, quote(f.name)+" = ?")
+		if fv, ok := fieldByIndex(v, f.index); ok {
+			args = append(args, fv.Interface())
+		} else {
+			args = append(args, nil)
+		}
+	}
+	return strings.Join(conds, " and "), args
+}
+
+func buildInsert(table string, v reflect.Value, fields []*field) (string, []interface{}, error) {
+	columns := make([]string, 0, len(fields))
+	args := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || ((f.autoIncrement || f.omitEmpty) && isEmptyValue(fv)) {
+			continue
+		}
+		arg, err := columnValue(f, fv)
+		if err != nil {
+			return "", nil, err
+		}
+		columns = append(columns, quote(f.name))
+		args = append(args, arg)
+		if f.blind != "" {
+			if arg, err = blindValue(f, fv); err != nil {
+				return "", nil, err
+			}
+			columns = append(columns, quote(f.blind))
+			args = append(args, arg)
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil, ErrorNoColumns
+	}
+	s := "insert into " + quote(table) + " (" + strings.Join(columns, ",") + ") values (" + placeholders(len(columns)) + ")"
+	return s, args, nil
+}
+
+func buildUpdate(table string, v reflect.Value, fields []*field, columns []string) (string, []interface{}, error) {
+	pks, err := primaryKeys(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	sd, err := softDeleteField(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	// soft deleted rows are left alone, Restore undeletes them
+	scope := scopeClause(sd, scopeAlive)
+	var only map[string]bool
+	if len(columns) > 0 {
+		only = make(map[string]bool, len(columns))
+		for _, c := range columns {
+			only[c] = true
+		}
+	}
+	sets := make([]string, 0, len(fields))
+	args := make([]interface{}, 0, len(fields)+len(pks))
+	for _, f := range fields {
+		if f.pk {
+			continue
+		}
+		fv, ok := fieldByIndex(v, f.index)
+		if only != nil {
+			if !only[f.name] {
+				continue
+			}
+			delete(only, f.name)
+			if !ok {
+				fv = reflect.Zero(f.typ)
+			}
+			if f.softDelete {
+				// named explicitly, the mark itself is updated whatever its state
+				scope = ""
+			}
+		} else if !ok || f.softDelete || (f.omitEmpty && isEmptyValue(fv)) {
+			// fields of a nil embedded pointer are left untouched
+			continue
+		}
+		arg, err := columnValue(f, fv)
+		if err != nil {
+			return "", nil, err
+		}
+		sets = append(sets, quote(f.name)+" = ?")
+		args = append(args, arg)
+		if f.blind != "" {
+			if arg, err = blindValue(f, fv); err != nil {
+				return "", nil, err
+			}
+			sets = append(sets, quote(f.blind)+" = ?")
+			args = append(args, arg)
+		}
+	}
+	for c := range only {
+		return "", nil, errors.New("unknown column:" + c)
+	}
+	if len(sets) == 0 {
+		return "", nil, ErrorNoColumns
+	}
+	where, whereArgs := whereClause(v, pks)
+	s := "update " + quote(table) + " set " + strings.Join(sets, ",") + " where " + where
+	if scope != "" {
+		s += " and " + scope
+	}
+	return s, append(args, whereArgs...), nil
+}
+
+func buildDelete(table string, v reflect.Value, fields []*field) (string, []interface{}, error) {
+	pks, err := primaryKeys(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	where, args := whereClause(v, pks)
+	return "delete from " + quote(table) + " where " + where, args, nil
+}
+
+// Insert writes the struct pointed by ptr as a new row of table once its valid tags pass.
+// Fields tagged autoincrement are skipped when zero and filled back from LastInsertId.
+func Insert(db *mysql.DBConfig, table string, ptr interface{}) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	if h, ok := ptr.(BeforeInserter); ok {
+		if err = h.BeforeInsert(); err != nil {
+			return err
+		}
+	}
+	if err = validateStruct(v, nil); err != nil {
+		return err
+	}
+	fields := typeFields(v.Type())
+	s, args, err := buildInsert(table, v, fields)
+	if err != nil {
+		return err
+	}
+	err = mysql.Insert(db, s, func(result sql.Result) error {
+		for _, f := range fields {
+			if !f.autoIncrement {
+				continue
+			}
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || !isEmptyValue(fv) {
+				continue
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			switch fv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				fv.SetInt(id)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				fv.SetUint(uint64(id))
+			default:
+				return errors.New("autoincrement field must be integer:" + f.name)
+			}
+		}
+		return nil
+	}, args...)
+	if err != nil {
+		return err
+	}
+	if h, ok := ptr.(AfterInserter); ok {
+		return h.AfterInsert()
+	}
+	return nil
+}
+
+// Update writes the struct pointed by ptr back to table, matching the row by its pk fields.
+// When columns are given only those are updated, otherwise every non pk field respecting omitempty.
+// A soft deleted row is not updated and the softdelete field is only written when named in columns.
+func Update(db *mysql.DBConfig, table string, ptr interface{}, columns ...string) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	if h, ok := ptr.(BeforeUpdater); ok {
+		if err = h.BeforeUpdate(); err != nil {
+			return err
+		}
+	}
+	var only map[string]bool
+	if len(columns) > 0 {
+		// the other fields are not written, their zero values must not fail
+		only = make(map[string]bool, len(columns))
+		for _, c := range columns {
+			only[c] = true
+		}
+	}
+	if err = validateStruct(v, only); err != nil {
+		return err
+	}
+	s, args, err := buildUpdate(table, v, typeFields(v.Type()), columns)
+	if err != nil {
+		return err
+	}
+	if err = mysql.Update(db, s, nil, args...); err != nil {
+		return err
+	}
+	if h, ok := ptr.(AfterUpdater); ok {
+		return h.AfterUpdate()
+	}
+	return nil
+}
+
+// Delete removes the row of table matching the pk fields of the struct pointed by ptr.
+// When the struct has a field tagged softdelete the row is kept and only marked deleted,
+// the field is set to the deletion time.
+func Delete(db *mysql.DBConfig, table string, ptr interface{}) error {
+	return deleteRow(db, table, ptr, false)
+}
+
+// HardDelete removes the row of table matching the pk fields of the struct pointed by ptr, even if it is soft deleted.
+func HardDelete(db *mysql.DBConfig, table string, ptr interface{}) error {
+	return deleteRow(db, table, ptr, true)
+}
+
+func deleteRow(db *mysql.DBConfig, table string, ptr interface{}, hard bool) error {
+	v, err := structValue(ptr)
+	if err != nil {
+		return err
+	}
+	if h, ok := ptr.(BeforeDeleter); ok {
+		if err = h.BeforeDelete(); err != nil {
+			return err
+		}
+	}
+	fields := typeFields(v.Type())
+	var sd *field
+	if !hard {
+		if sd, err = softDeleteField(fields); err != nil {
+			return err
+		}
+	}
+	if sd != nil {
+		now := time.Now()
+		s, args, err := buildSoftDelete(table, v, fields, sd, now)
+		if err != nil {
+			return err
+		}
+		if err = mysql.Update(db, s, nil, args...); err != nil {
+			return err
+		}
+		if fv, ok := fieldByIndex(v, sd.index); ok {
+			setDeleted(sd, fv, now)
+		}
+	} else {
+		s, args, err := buildDelete(table, v, fields)
+		if err != nil {
+			return err
+		}
+		if err = mysql.Delete(db, s, nil, args...); err != nil {
+			return err
+		}
+	}
+	if h, ok := ptr.(AfterDeleter); ok {
+		return h.AfterDelete()
+	}
+	return nil
+}
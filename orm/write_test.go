@@ -0,0 +1,55 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Account struct {
+	ID         int64     `orm:"id,pk,autoincrement"`
+	Name       string    `orm:"name"`
+	Mobile     string    `orm:"mobile,omitempty"`
+	CreateTime time.Time `orm:"create_time"`
+	Remark     string    `orm:"-"`
+}
+
+func TestBuildInsert(t *testing.T) {
+	a := &Account{Name: "tom"}
+	v := reflect.ValueOf(a).Elem()
+	s, args, err := buildInsert("account", v, typeFields(v.Type()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "insert into `account` (`name`,`create_time`) values (?,?)" {
+		t.Fatal(s)
+	}
+	if len(args) != 2 || args[0] != "tom" {
+		t.Fatal(args)
+	}
+}
+
+func TestBuildUpdate(t *testing.T) {
+	a := &Account{ID: 3, Name: "tom", Mobile: "186"}
+	v := reflect.ValueOf(a).Elem()
+	s, args, err := buildUpdate("account", v, typeFields(v.Type()), []string{"mobile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "update `account` set `mobile` = ? where `id` = ?" {
+		t.Fatal(s)
+	}
+	if len(args) != 2 || args[0] != "186" || args[1] != int64(3) {
+		t.Fatal(args)
+	}
+	if _, _, err := buildUpdate("account", v, typeFields(v.Type()), []string{"nope"}); err == nil {
+		t.Fatal("expected unknown column error")
+	}
+}
+
+func TestBuildDelete(t *testing.T) {
+	v := reflect.ValueOf(&Token{}).Elem()
+	if _, _, err := buildDelete("token", v, typeFields(v.Type())); err != ErrorNoPrimaryKey {
+		t.Fatal(err)
+	}
+}
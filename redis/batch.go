@@ -0,0 +1,294 @@
+package redis
+
+import (
+	"errors"
+	redis2 "github.com/go-redis/redis"
+	"github.com/yanzongzhen/Logger/logger"
+	mrand "math/rand"
+	"reflect"
+	"time"
+)
+
+var (
+	ErrorNotExecuted = errors.New("batch not executed")
+	ErrorTxConflict  = errors.New("transaction conflict, watched keys changed")
+)
+
+// result is the reply of one queued operation, available once the batch executed
+type result struct {
+	cmd redis2.Cmder
+}
+
+// Err returns the error of the operation, ErrorNotExist for a missing key
+func (r *result) Err() error {
+	if r.cmd == nil {
+		return ErrorNotExecuted
+	}
+	if err := r.cmd.Err(); err != nil {
+		if err == redis2.Nil {
+			return ErrorNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// StatusResult is the reply of Set
+type StatusResult struct {
+	result
+}
+
+// StringResult is the reply of Get and HGet
+type StringResult struct {
+	result
+	codec Codec
+}
+
+// Scan decodes the value into value like Get does
+func (r *StringResult) Scan(value interface{}) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("value must be pointer")
+	}
+	return decodeValue(r.codec, r.cmd.(*redis2.StringCmd).Val(), value)
+}
+
+// Val returns the raw value
+func (r *StringResult) Val() (string, error) {
+	if err := r.Err(); err != nil {
+		return "", err
+	}
+	return r.cmd.(*redis2.StringCmd).Val(), nil
+}
+
+// IntResult is the reply of Incr, IncrBy and Delete
+type IntResult struct {
+	result
+}
+
+func (r *IntResult) Val() (int64, error) {
+	if err := r.Err(); err != nil {
+		return -1, err
+	}
+	return r.cmd.(*redis2.IntCmd).Val(), nil
+}
+
+// BoolResult is the reply of HSet, true when the field was created, and Expire, false when the key does not exist
+type BoolResult struct {
+	result
+}
+
+func (r *BoolResult) Val() (bool, error) {
+	if err := r.Err(); err != nil {
+		return false, err
+	}
+	return r.cmd.(*redis2.BoolCmd).Val(), nil
+}
+
+type pipelineFunc func(fn func(redis2.Pipeliner) error) ([]redis2.Cmder, error)
+
+// Batch queues operations and sends them in a single round trip.
+// The results are filled by Exec, or by ExecTx which wraps the operations in MULTI/EXEC.
+//
+//	b := redis.NewBatch(config)
+//	b.Set("user:1", data, time.Hour)
+//	n := b.Incr("user:count")
+//	if err := b.ExecTx(); err != nil { ... }
+//	count, err := n.Val()
+type Batch struct {
+	config *Config
+	ops    []func(p redis2.Pipeliner)
+	// err is the first value that could not be encoded, Exec then sends nothing
+	err error
+}
+
+func NewBatch(config *Config) *Batch {
+	return &Batch{config: config}
+}
+
+// Len returns the number of queued operations
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// encode returns value as sent by Set, an encoding error fails the whole batch
+func (b *Batch) encode(value interface{}) interface{} {
+	v, err := encodeValue(b.config.codec(), value)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return v
+}
+
+func (b *Batch) Set(key string, value interface{}, expireTime time.Duration) *StatusResult {
+	r := &StatusResult{}
+	v := b.encode(value)
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.Set(key, v, expireTime) })
+	return r
+}
+
+func (b *Batch) HSet(key string, field string, value interface{}) *BoolResult {
+	r := &BoolResult{}
+	v := b.encode(value)
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.HSet(key, field, v) })
+	return r
+}
+
+func (b *Batch) Get(key string) *StringResult {
+	r := &StringResult{codec: b.config.codec()}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.Get(key) })
+	return r
+}
+
+func (b *Batch) HGet(key string, field string) *StringResult {
+	r := &StringResult{codec: b.config.codec()}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.HGet(key, field) })
+	return r
+}
+
+func (b *Batch) Incr(key string) *IntResult {
+	r := &IntResult{}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.Incr(key) })
+	return r
+}
+
+func (b *Batch) IncrBy(key string, num int64) *IntResult {
+	r := &IntResult{}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.IncrBy(key, num) })
+	return r
+}
+
+func (b *Batch) Expire(key string, expireTime time.Duration) *BoolResult {
+	r := &BoolResult{}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.Expire(key, expireTime) })
+	return r
+}
+
+// Delete returns the number of keys removed
+func (b *Batch) Delete(key ...string) *IntResult {
+	r := &IntResult{}
+	b.ops = append(b.ops, func(p redis2.Pipeliner) { r.cmd = p.Del(key...) })
+	return r
+}
+
+// Exec sends the queued operations in one pipeline, they are not atomic.
+// It returns the first failed operation error, a missing key is not an error of the batch.
+func (b *Batch) Exec() error {
+	client := initRedisClient(b.config)
+	if client == nil {
+		return errors.New("connect redis error")
+	}
+	return b.run(client.Pipelined)
+}
+
+// ExecTx sends the queued operations in one MULTI/EXEC transaction.
+// In cluster mode all keys must hash to the same slot, e.g. with a {tag}.
+func (b *Batch) ExecTx() error {
+	client := initRedisClient(b.config)
+	if client == nil {
+		return errors.New("connect redis error")
+	}
+	return b.run(client.TxPipelined)
+}
+
+func (b *Batch) run(pipelined pipelineFunc) error {
+	ops, err := b.ops, b.err
+	b.ops, b.err = nil, nil
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	cmds, err := pipelined(func(p redis2.Pipeliner) error {
+		for _, op := range ops {
+			op(p)
+		}
+		return nil
+	})
+	// the pipeline reports the first failed command, which may just be a missing key
+	for _, cmd := range cmds {
+		if e := cmd.Err(); e != nil && e != redis2.Nil {
+			return e
+		}
+	}
+	if err == redis2.Nil {
+		return nil
+	}
+	return err
+}
+
+// Tx is an optimistic transaction of Watch.
+// Reads go to the server at once, writes are queued on the embedded Batch and
+// committed with MULTI/EXEC when the watched keys did not change meanwhile.
+type Tx struct {
+	*Batch
+	tx *redis2.Tx
+}
+
+// Get reads key inside the transaction, like Get
+func (t *Tx) Get(key string, value interface{}) error {
+	return scanString(t.config.codec(), t.tx.Get(key), value)
+}
+
+// HGet reads field of key inside the transaction, like HGet
+func (t *Tx) HGet(key string, field string, value interface{}) error {
+	return scanString(t.config.codec(), t.tx.HGet(key, field), value)
+}
+
+func scanString(codec Codec, res *redis2.StringCmd, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("value must be pointer")
+	}
+	if err := res.Err(); err != nil {
+		if err == redis2.Nil {
+			return ErrorNotExist
+		}
+		return err
+	}
+	return decodeValue(codec, res.Val(), value)
+}
+
+// Watch runs fn in an optimistic transaction on keys.
+// When a watched key changes before the commit, fn runs again up to maxRetries times,
+// then ErrorTxConflict is returned. An error of fn aborts without writing.
+//
+//	err := redis.Watch(config, 10, func(tx *redis.Tx) error {
+//		var n int64
+//		if err := tx.Get("stock", &n); err != nil { return err }
+//		if n <= 0 { return errSoldOut }
+//		tx.Set("stock", n-1, 0)
+//		return nil
+//	}, "stock")
+func Watch(config *Config, maxRetries int, fn func(tx *Tx) error, keys ...string) error {
+	client := initRedisClient(config)
+	if client == nil {
+		return errors.New("connect redis error")
+	}
+	wait := 5 * time.Millisecond
+	for i := 0; ; i++ {
+		err := client.Watch(func(tx *redis2.Tx) error {
+			t := &Tx{Batch: &Batch{config: config}, tx: tx}
+			if err := fn(t); err != nil {
+				return err
+			}
+			return t.run(tx.TxPipelined)
+		}, keys...)
+		if err != redis2.TxFailedErr {
+			return err
+		}
+		if i >= maxRetries {
+			return ErrorTxConflict
+		}
+		logger.Debug("watch conflict, retry")
+		// jitter keeps the conflicting writers from colliding again
+		time.Sleep(wait/2 + time.Duration(mrand.Int63n(int64(wait/2)+1)))
+		if wait *= 2; wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+	}
+}
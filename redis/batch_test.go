@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"errors"
+	redis2 "github.com/go-redis/redis"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchResults(t *testing.T) {
+	b := NewBatch(&Config{})
+	get := b.Get("k")
+	n := b.Incr("n")
+	if b.Len() != 2 {
+		t.Fatal(b.Len())
+	}
+	if _, err := get.Val(); err != ErrorNotExecuted {
+		t.Fatal(err)
+	}
+	if _, err := n.Val(); err != ErrorNotExecuted {
+		t.Fatal(err)
+	}
+
+	// a missing key fails its own result only
+	err := b.run(func(fn func(redis2.Pipeliner) error) ([]redis2.Cmder, error) {
+		s := redis2.NewStringResult("", redis2.Nil)
+		i := redis2.NewIntResult(3, nil)
+		get.cmd, n.cmd = s, i
+		return []redis2.Cmder{s, i}, redis2.Nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 0 {
+		t.Fatal("batch not reset")
+	}
+	if _, err := get.Val(); err != ErrorNotExist {
+		t.Fatal(err)
+	}
+	if v, err := n.Val(); err != nil || v != 3 {
+		t.Fatal(v, err)
+	}
+
+	b.Set("k", 1, 0)
+	failed := errors.New("READONLY")
+	err = b.run(func(fn func(redis2.Pipeliner) error) ([]redis2.Cmder, error) {
+		s := redis2.NewStringResult("", redis2.Nil)
+		return []redis2.Cmder{s, redis2.NewStatusResult("", failed)}, redis2.Nil
+	})
+	if err != failed {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	config := testConfig(t)
+	_ = Delete(config, "test:batch:s", "test:batch:n", "test:batch:h")
+
+	b := NewBatch(config)
+	b.Set("test:batch:s", "v", time.Minute)
+	b.HSet("test:batch:h", "f", 7)
+	n := b.Incr("test:batch:n")
+	missing := b.Get("test:batch:missing")
+	if err := b.ExecTx(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := n.Val(); err != nil || v != 1 {
+		t.Fatal(v, err)
+	}
+	if err := missing.Err(); err != ErrorNotExist {
+		t.Fatal(err)
+	}
+
+	s := b.Get("test:batch:s")
+	h := b.HGet("test:batch:h", "f")
+	e := b.Expire("test:batch:n", time.Minute)
+	if err := b.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	var f int
+	if v, _ := s.Val(); v != "v" {
+		t.Fatal(v)
+	}
+	if err := h.Scan(&f); err != nil || f != 7 {
+		t.Fatal(f, err)
+	}
+	if ok, err := e.Val(); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	d := b.Delete("test:batch:s", "test:batch:n", "test:batch:h")
+	if err := b.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.Val(); v != 3 {
+		t.Fatal(v)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	config := testConfig(t)
+	_ = Delete(config, "test:watch")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Watch(config, 100, func(tx *Tx) error {
+				var n int64
+				if err := tx.Get("test:watch", &n); err != nil && err != ErrorNotExist {
+					return err
+				}
+				tx.Set("test:watch", n+1, time.Minute)
+				return nil
+			}, "test:watch")
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	var n int64
+	if err := Get(config, "test:watch", &n); err != nil || n != 10 {
+		t.Fatal(n, err)
+	}
+	_ = Delete(config, "test:watch")
+}
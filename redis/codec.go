@@ -0,0 +1,243 @@
+package redis
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codec serializes the values redis can't store as is: structs, slices, maps and named types.
+// Strings, []byte, numbers, bools and encoding.BinaryMarshaler values are always stored raw.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type funcCodec struct {
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+func (c funcCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.marshal(v)
+}
+
+func (c funcCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.unmarshal(data, v)
+}
+
+var (
+	// JSONCodec is the default codec
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec is compact for Go only readers, interface fields need gob.Register
+	GobCodec Codec = gobCodec{}
+)
+
+// NewCodec builds a codec of a marshal and unmarshal pair, e.g. for msgpack:
+//
+//	config.Codec = redis.NewCodec(msgpack.Marshal, msgpack.Unmarshal)
+func NewCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) Codec {
+	return funcCodec{marshal: marshal, unmarshal: unmarshal}
+}
+
+// WithCodec returns a copy of config using codec, for a single call.
+// The copy shares the connection of config.
+//
+//	err := redis.Get(redis.WithCodec(config, redis.GobCodec), key, &session)
+func WithCodec(config *Config, codec Codec) *Config {
+	c := *config
+	c.Codec = codec
+	return &c
+}
+
+func (config *Config) codec() Codec {
+	if config == nil || config.Codec == nil {
+		return JSONCodec
+	}
+	return config.Codec
+}
+
+// encodeValue returns v as go-redis writes it, marshaled with codec unless it is a raw value
+func encodeValue(codec Codec, v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, string, []byte, bool, float32, float64,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		encoding.BinaryMarshaler:
+		return v, nil
+	}
+	return codec.Marshal(v)
+}
+
+// decodeValue stores data in the pointer value, unmarshaled with codec unless it is a raw value
+func decodeValue(codec Codec, data string, value interface{}) error {
+	switch value.(type) {
+	case *string, *[]byte, *bool, *float32, *float64,
+		*int, *int8, *int16, *int32, *int64, *uint, *uint8, *uint16, *uint32, *uint64,
+		encoding.BinaryUnmarshaler:
+		return decodeField(codec, data, reflect.ValueOf(value).Elem())
+	}
+	return codec.Unmarshal([]byte(data), value)
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	stringType = reflect.TypeOf("")
+)
+
+// decodeField parses s, as written by go-redis, into v
+func decodeField(codec Codec, s string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeField(codec, s, v.Elem())
+	}
+	if u, ok := v.Addr().Interface().(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if v.Type() != stringType {
+			// named string types go through the codec like in Set
+			break
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		v.SetBool(s == "1" || s == "true")
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			return errors.New("can't parse " + s + " to " + v.Type().String())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			return errors.New("can't parse " + s + " to " + v.Type().String())
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("can't parse " + s + " to " + v.Type().String())
+		}
+		v.SetFloat(n)
+		return nil
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(s))
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+	return codec.Unmarshal([]byte(s), v.Addr().Interface())
+}
+
+// hashField is a struct field stored in a hash field, named by the redis tag, e.g. `redis:"name"`.
+// Untagged fields keep their Go name, "-" skips the field.
+type hashField struct {
+	index int
+	name  string
+}
+
+func hashFields(t reflect.Type) []hashField {
+	fields := make([]hashField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := sf.Tag.Get("redis")
+		if idx := strings.Index(name, ","); idx != -1 {
+			name = name[:idx]
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, hashField{index: i, name: name})
+	}
+	return fields
+}
+
+// decodeHash stores the fields of a hash into value, a pointer to a struct or a map with string keys
+func decodeHash(codec Codec, data map[string]string, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("value must be pointer")
+	}
+	v := rv.Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			break
+		}
+		for _, f := range hashFields(v.Type()) {
+			s, ok := data[f.name]
+			if !ok {
+				continue
+			}
+			if err := decodeField(codec, s, v.Field(f.index)); err != nil {
+				return errors.New(f.name + ": " + err.Error())
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.New("key type not support:" + v.Type().Key().Kind().String())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for k, s := range data {
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeField(codec, s, e); err != nil {
+				return errors.New(k + ": " + err.Error())
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), e)
+		}
+		return nil
+	}
+	return errors.New("un support type:" + v.Kind().String())
+}
@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type codecUser struct {
+	ID      int64             `redis:"id"`
+	Name    string            `redis:"name"`
+	Score   float64           `redis:"score"`
+	Active  bool              `redis:"active"`
+	Tags    []string          `redis:"tags"`
+	Created time.Time         `redis:"created"`
+	Extra   map[string]string `redis:"extra"`
+	Nick    *string
+	Skip    string `redis:"-"`
+}
+
+func TestCodecValues(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		in := codecUser{ID: 1, Name: "a", Tags: []string{"x"}}
+		v, err := encodeValue(codec, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			t.Fatalf("%T", v)
+		}
+		var out codecUser
+		if err := decodeValue(codec, string(b), &out); err != nil || !reflect.DeepEqual(in, out) {
+			t.Fatal(out, err)
+		}
+	}
+	for _, raw := range []interface{}{"s", []byte("b"), 3, 1.5, true, time.Now()} {
+		if v, _ := encodeValue(JSONCodec, raw); !reflect.DeepEqual(v, raw) {
+			t.Fatal("raw value encoded", raw)
+		}
+	}
+	var n int
+	if err := decodeValue(JSONCodec, "42", &n); err != nil || n != 42 {
+		t.Fatal(n, err)
+	}
+	var s string
+	if err := decodeValue(JSONCodec, `"q"`, &s); err != nil || s != `"q"` {
+		t.Fatal(s, err)
+	}
+
+	config := NewRedisConfig("127.0.0.1:6379", "", 0)
+	gob := WithCodec(config, GobCodec)
+	if config.codec() != JSONCodec || gob.codec() != GobCodec || gob.getConfigStr() != config.getConfigStr() {
+		t.Fatal("per call codec")
+	}
+	b := NewBatch(config)
+	b.Set("k", func() {}, 0)
+	if err := b.run(nil); err == nil || b.Len() != 0 {
+		t.Fatal("expected encode error", err)
+	}
+}
+
+func TestDecodeHash(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tm, _ := created.MarshalBinary()
+	data := map[string]string{
+		"id":      "7",
+		"name":    "bob",
+		"score":   "1.5",
+		"active":  "1",
+		"tags":    `["a","b"]`,
+		"created": string(tm),
+		"extra":   `{"k":"v"}`,
+		"Nick":    "bobby",
+		"Skip":    "x",
+		"unknown": "x",
+	}
+	var u codecUser
+	if err := decodeHash(JSONCodec, data, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 7 || u.Name != "bob" || u.Score != 1.5 || !u.Active || len(u.Tags) != 2 ||
+		!u.Created.Equal(created) || u.Extra["k"] != "v" || u.Nick == nil || *u.Nick != "bobby" || u.Skip != "" {
+		t.Fatal(u)
+	}
+
+	var m map[string]int
+	if err := decodeHash(JSONCodec, map[string]string{"a": "1", "b": "2"}, &m); err != nil || m["b"] != 2 {
+		t.Fatal(m, err)
+	}
+	if err := decodeHash(JSONCodec, map[string]string{"id": "x"}, &u); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if err := decodeHash(JSONCodec, data, u); err == nil {
+		t.Fatal("expected pointer error")
+	}
+}
@@ -0,0 +1,297 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	redis2 "github.com/go-redis/redis"
+	"github.com/yanzongzhen/Logger/logger"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+var ErrorLockNotHeld = errors.New("lock not held")
+
+// the lock is only released or extended by the holder of the token
+var (
+	unlockScript = redis2.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+	extendScript = redis2.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+)
+
+// LockOptions tunes a Lock, zero values keep the defaults
+type LockOptions struct {
+	// TTL of the key, 10s by default. The lock is lost when the holder neither unlocks nor extends it in time.
+	TTL time.Duration
+	// AutoRenew extends the TTL every TTL/3 in the background until Unlock
+	AutoRenew bool
+	// RetryInterval is the first wait of Lock between two attempts, 50ms by default, it doubles up to MaxRetryInterval
+	RetryInterval time.Duration
+	// MaxRetryInterval caps the wait of Lock between two attempts, 1s by default
+	MaxRetryInterval time.Duration
+}
+
+// Lock is a distributed lock held with a random token.
+// With several Configs it follows the Redlock algorithm: the lock is held once a majority of the
+// independent instances accepted it within its TTL. The instances are asked concurrently,
+// each has TTL/10 to answer.
+//
+//	l := redis.NewLock(config, "lock:order:"+id, &redis.LockOptions{TTL: 30 * time.Second, AutoRenew: true})
+//	if err := l.Lock(ctx); err != nil { ... }
+//	defer l.Unlock()
+type Lock struct {
+	configs []*Config
+	key     string
+	ttl     time.Duration
+	opts    LockOptions
+
+	mu    sync.Mutex
+	token string
+	stop  chan struct{}
+	lost  chan struct{}
+}
+
+// NewLock returns the lock named key on config
+func NewLock(config *Config, key string, opts *LockOptions) *Lock {
+	return NewRedlock([]*Config{config}, key, opts)
+}
+
+// NewRedlock returns the lock named key across the independent instances of configs
+func NewRedlock(configs []*Config, key string, opts *LockOptions) *Lock {
+	l := &Lock{configs: configs, key: key}
+	if opts != nil {
+		l.opts = *opts
+	}
+	if l.opts.TTL <= 0 {
+		l.opts.TTL = 10 * time.Second
+	}
+	if l.opts.RetryInterval <= 0 {
+		l.opts.RetryInterval = 50 * time.Millisecond
+	}
+	if l.opts.MaxRetryInterval <= 0 {
+		l.opts.MaxRetryInterval = time.Second
+	}
+	l.ttl = l.opts.TTL
+	return l
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (l *Lock) quorum() int {
+	return len(l.configs)/2 + 1
+}
+
+// drift is the clock drift allowance of Redlock
+func (l *Lock) drift() time.Duration {
+	return l.ttl/100 + 2*time.Millisecond
+}
+
+// Token returns the token of the current holding, empty when the lock is not held
+func (l *Lock) Token() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// TryLock makes a single attempt, it returns false without error when another holder has the lock
+func (l *Lock) TryLock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token != "" {
+		return false, errors.New("lock already held by this Lock")
+	}
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	n, lastErr := l.each(func(config *Config) (bool, error) {
+		return SetNX(config, l.key, token, l.ttl)
+	})
+	validity := l.ttl - time.Since(start) - l.drift()
+	if n < l.quorum() || validity <= 0 {
+		// release the minority that was acquired
+		l.release(token)
+		if n == 0 && lastErr != nil {
+			return false, lastErr
+		}
+		return false, nil
+	}
+	l.token = token
+	l.lost = make(chan struct{})
+	if l.opts.AutoRenew {
+		l.stop = make(chan struct{})
+		go l.renew(token, l.stop, l.lost)
+	}
+	return true, nil
+}
+
+// Lock waits for the lock, retrying with exponential backoff and jitter until ctx is done.
+// It then returns ctx.Err(), wrapped with the last error of the attempts if any, test it with errors.Is.
+func (l *Lock) Lock(ctx context.Context) error {
+	wait := l.opts.RetryInterval
+	var lastErr error
+	for {
+		ok, err := l.TryLock()
+		if ok {
+			return nil
+		}
+		if err != nil {
+			logger.Error(err)
+			lastErr = err
+		}
+		// jitter keeps competing holders from retrying in lockstep
+		d := wait/2 + time.Duration(mrand.Int63n(int64(wait/2)+1))
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr != nil {
+				return fmt.Errorf("%w, last error: %v", ctx.Err(), lastErr)
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if wait *= 2; wait > l.opts.MaxRetryInterval {
+			wait = l.opts.MaxRetryInterval
+		}
+	}
+}
+
+// Extend resets the TTL of the held lock, ErrorLockNotHeld when it expired or was taken over
+func (l *Lock) Extend() error {
+	l.mu.Lock()
+	token := l.token
+	l.mu.Unlock()
+	if token == "" {
+		return ErrorLockNotHeld
+	}
+	return l.extend(token)
+}
+
+func (l *Lock) extend(token string) error {
+	n, lastErr := l.each(func(config *Config) (bool, error) {
+		client := initRedisClient(config)
+		if client == nil {
+			return false, errors.New("connect redis error")
+		}
+		res, err := extendScript.Run(client, []string{l.key}, token, int64(l.ttl/time.Millisecond)).Int64()
+		return res == 1, err
+	})
+	if n >= l.quorum() {
+		return nil
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	return ErrorLockNotHeld
+}
+
+func (l *Lock) renew(token string, stop, lost chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := l.extend(token); err == ErrorLockNotHeld {
+			logger.Error("lost lock " + l.key)
+			close(lost)
+			return
+		} else if err != nil {
+			// transient, retried on the next tick while the ttl lasts
+			logger.Error(err)
+		}
+	}
+}
+
+// Lost is closed when auto renewal finds the lock expired or taken over, the holder should stop its work
+func (l *Lock) Lost() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Unlock releases the lock if it is still held with our token, ErrorLockNotHeld when it expired meanwhile
+func (l *Lock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == "" {
+		return ErrorLockNotHeld
+	}
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	n, err := l.release(l.token)
+	l.token = ""
+	if err != nil {
+		return err
+	}
+	if n < l.quorum() {
+		return ErrorLockNotHeld
+	}
+	return nil
+}
+
+// release deletes the key on every instance where it still holds token and returns how many did
+func (l *Lock) release(token string) (int, error) {
+	return l.each(func(config *Config) (bool, error) {
+		client := initRedisClient(config)
+		if client == nil {
+			return false, errors.New("connect redis error")
+		}
+		res, err := unlockScript.Run(client, []string{l.key}, token).Int64()
+		return res == 1, err
+	})
+}
+
+// instanceTimeout bounds the wait for each instance, a slow or unreachable one
+// must not use up the validity of the lock
+func (l *Lock) instanceTimeout() time.Duration {
+	return l.ttl / 10
+}
+
+// each runs fn on all instances concurrently and returns how many reported true
+// and the last error. An instance that does not answer within instanceTimeout counts as failed.
+func (l *Lock) each(fn func(config *Config) (bool, error)) (int, error) {
+	type reply struct {
+		ok  bool
+		err error
+	}
+	// buffered, the goroutines of late instances finish without a reader
+	replies := make(chan reply, len(l.configs))
+	for _, config := range l.configs {
+		go func(config *Config) {
+			ok, err := fn(config)
+			replies <- reply{ok, err}
+		}(config)
+	}
+	timer := time.NewTimer(l.instanceTimeout())
+	defer timer.Stop()
+	n := 0
+	var lastErr error
+	for range l.configs {
+		select {
+		case r := <-replies:
+			if r.err != nil {
+				lastErr = r.err
+			} else if r.ok {
+				n++
+			}
+		case <-timer.C:
+			return n, errors.New("redis lock instance timeout")
+		}
+	}
+	return n, lastErr
+}
@@ -0,0 +1,144 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"github.com/yanzongzhen/Logger/logger"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// testConfig returns the server of REDIS_TEST_URL, the test is skipped without one
+func testConfig(t *testing.T) *Config {
+	url := os.Getenv("REDIS_TEST_URL")
+	if url == "" {
+		t.Skip("REDIS_TEST_URL not set")
+	}
+	logger.InitLogConfig(logger.ERROR, true)
+	return NewRedisConfig(url, os.Getenv("REDIS_TEST_PASSWORD"), 0)
+}
+
+func TestLockOptions(t *testing.T) {
+	l := NewRedlock([]*Config{{}, {}, {}, {}, {}}, "k", nil)
+	if l.quorum() != 3 || l.ttl != 10*time.Second || l.opts.RetryInterval != 50*time.Millisecond {
+		t.Fatal(l.quorum(), l.ttl, l.opts)
+	}
+	if l.drift() != 102*time.Millisecond {
+		t.Fatal(l.drift())
+	}
+	if NewLock(&Config{}, "k", nil).quorum() != 1 {
+		t.Fatal("single instance quorum")
+	}
+	a, _ := newToken()
+	b, _ := newToken()
+	if a == b || len(a) != 32 {
+		t.Fatal(a, b)
+	}
+	if err := l.Unlock(); err != ErrorLockNotHeld {
+		t.Fatal(err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	config := testConfig(t)
+	key := "test:lock:" + time.Now().String()
+	opts := &LockOptions{TTL: 300 * time.Millisecond, AutoRenew: true, RetryInterval: 10 * time.Millisecond}
+	first := NewLock(config, key, opts)
+	second := NewLock(config, key, opts)
+
+	if ok, err := first.TryLock(); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if ok, err := second.TryLock(); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	// auto renewal keeps the lock past its ttl
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := second.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	// another holder can't release our lock
+	if n, _ := second.release("not-our-token"); n != 0 {
+		t.Fatal(n)
+	}
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if err := second.Lock(ctx2); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// silentConfig points at a server that accepts connections and never answers, like an unreachable instance
+func silentConfig(t *testing.T) (*Config, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []net.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+	config := NewRedisConfig(ln.Addr().String(), "", 0)
+	config.ReadTimeout = time.Second
+	return config, func() {
+		_ = ln.Close()
+		<-done
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	}
+}
+
+func TestLockInstanceTimeout(t *testing.T) {
+	logger.InitLogConfig(logger.ERROR, true)
+	silent, closeSilent := silentConfig(t)
+	defer closeSilent()
+	l := NewLock(silent, "test:lock", &LockOptions{TTL: time.Second})
+	start := time.Now()
+	if ok, err := l.TryLock(); ok || err == nil {
+		t.Fatal(ok, err)
+	}
+	// the acquire and the release of the minority each wait ttl/10 at most
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatal("waited", d)
+	}
+
+	// a failing instance still ends with the error of ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := l.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) || err == context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+}
+
+func TestRedlockUnreachable(t *testing.T) {
+	config := testConfig(t)
+	silent, closeSilent := silentConfig(t)
+	defer closeSilent()
+	other := NewRedisConfig(config.Url, config.Password, 1)
+	key := "test:redlock:" + time.Now().String()
+	l := NewRedlock([]*Config{config, silent, other}, key, &LockOptions{TTL: time.Second})
+	if ok, err := l.TryLock(); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,251 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	redis2 "github.com/go-redis/redis"
+	"github.com/yanzongzhen/Logger/logger"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a message arriving while the buffer of a Subscription is full
+type OverflowPolicy int
+
+const (
+	// DropNewest discards the arriving message
+	DropNewest OverflowPolicy = iota
+	// DropOldest discards the oldest buffered message to make room
+	DropOldest
+	// Block stops reading until the handler catches up, the server buffers meanwhile
+	// and may disconnect the client when its output buffer limit is hit
+	Block
+)
+
+// SubscribeOptions tunes a Subscription, zero values keep the defaults
+type SubscribeOptions struct {
+	// BufferSize is the number of messages waiting for the handler, 100 by default
+	BufferSize int
+	// Overflow is the policy of a full buffer, DropNewest by default
+	Overflow OverflowPolicy
+	// HealthCheck is the idle time after which the connection is pinged, 30s by default
+	HealthCheck time.Duration
+}
+
+// Message is a message received on a channel, Pattern is set for PSubscribe
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+type MessageHandler func(msg *Message)
+
+// Subscription delivers the messages of its channels to a handler goroutine one at a time.
+// A lost connection is redialed and the channels are subscribed again, messages published
+// meanwhile are lost as pub/sub does not keep them.
+type Subscription struct {
+	ps      *redis2.PubSub
+	opts    SubscribeOptions
+	msgs    chan *Message
+	stop    chan struct{}
+	once    sync.Once
+	done    chan struct{}
+	dropped int64
+	// handler is the goroutine id of handle, Close does not wait when called from it
+	handler int64
+}
+
+// Publish sends msg to channel and returns the number of clients that received it
+func Publish(config *Config, channel string, msg interface{}) (int64, error) {
+	client := initRedisClient(config)
+	if client == nil {
+		return 0, errors.New("connect redis error")
+	}
+	return client.Publish(channel, msg).Result()
+}
+
+// Subscribe calls handler with the messages of channels until ctx is done or Close is called.
+//
+//	sub, err := redis.Subscribe(ctx, config, func(msg *redis.Message) { ... }, nil, "orders")
+//	defer sub.Close()
+func Subscribe(ctx context.Context, config *Config, handler MessageHandler, opts *SubscribeOptions, channels ...string) (*Subscription, error) {
+	return subscribe(ctx, config, handler, opts, false, channels)
+}
+
+// PSubscribe is Subscribe with glob patterns, e.g. "orders.*"
+func PSubscribe(ctx context.Context, config *Config, handler MessageHandler, opts *SubscribeOptions, patterns ...string) (*Subscription, error) {
+	return subscribe(ctx, config, handler, opts, true, patterns)
+}
+
+func subscribe(ctx context.Context, config *Config, handler MessageHandler, opts *SubscribeOptions, pattern bool, channels []string) (*Subscription, error) {
+	if handler == nil {
+		return nil, errors.New("handler is nil")
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("no channel to subscribe")
+	}
+	client := initRedisClient(config)
+	if client == nil {
+		return nil, errors.New("connect redis error")
+	}
+	s := newSubscription(opts)
+	if pattern {
+		s.ps = client.PSubscribe(channels...)
+	} else {
+		s.ps = client.Subscribe(channels...)
+	}
+	// wait for the confirmation so that a refused subscription is reported here
+	if _, err := s.ps.ReceiveTimeout(s.opts.HealthCheck); err != nil {
+		_ = s.ps.Close()
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.once.Do(func() { close(s.stop) })
+		case <-s.stop:
+		}
+		// unblocks receive
+		_ = s.ps.Close()
+	}()
+	go s.receive()
+	go s.handle(handler)
+	return s, nil
+}
+
+func newSubscription(opts *SubscribeOptions) *Subscription {
+	s := &Subscription{stop: make(chan struct{}), done: make(chan struct{})}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.BufferSize <= 0 {
+		s.opts.BufferSize = 100
+	}
+	if s.opts.HealthCheck <= 0 {
+		s.opts.HealthCheck = 30 * time.Second
+	}
+	s.msgs = make(chan *Message, s.opts.BufferSize)
+	return s
+}
+
+func (s *Subscription) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Subscription) receive() {
+	defer close(s.msgs)
+	wait := 100 * time.Millisecond
+	for !s.stopped() {
+		msg, err := s.ps.ReceiveTimeout(s.opts.HealthCheck)
+		if err != nil {
+			if s.stopped() {
+				return
+			}
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				// idle, a failed ping marks the connection bad so that the next receive redials
+				if err := s.ps.Ping(); err != nil {
+					logger.Error(err)
+				}
+				continue
+			}
+			// the next receive redials and subscribes the channels again
+			logger.Error(err)
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(wait):
+			}
+			if wait *= 2; wait > 5*time.Second {
+				wait = 5 * time.Second
+			}
+			continue
+		}
+		wait = 100 * time.Millisecond
+		if m, ok := msg.(*redis2.Message); ok {
+			s.push(&Message{Channel: m.Channel, Pattern: m.Pattern, Payload: m.Payload})
+		}
+	}
+}
+
+// push buffers m following the overflow policy
+func (s *Subscription) push(m *Message) {
+	switch s.opts.Overflow {
+	case Block:
+		select {
+		case s.msgs <- m:
+		case <-s.stop:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.msgs <- m:
+				return
+			default:
+			}
+			select {
+			case <-s.msgs:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.msgs <- m:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+// handle delivers the messages, the ones still buffered at unsubscribe are delivered too
+func (s *Subscription) handle(handler MessageHandler) {
+	defer close(s.done)
+	atomic.StoreInt64(&s.handler, goid())
+	for m := range s.msgs {
+		handler(m)
+	}
+}
+
+// Dropped returns the number of messages discarded by the overflow policy
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Done is closed once the subscription ended and the handler returned for the last message
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close unsubscribes and waits for the handler to finish the buffered messages.
+// Called from the handler it returns at once, as waiting for itself would deadlock:
+// the buffered messages are still delivered after the handler returned, then Done is closed.
+func (s *Subscription) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	if goid() == atomic.LoadInt64(&s.handler) {
+		return nil
+	}
+	<-s.done
+	return nil
+}
+
+// goid returns the id of the calling goroutine, read from the "goroutine N [" header of its stack
+func goid() int64 {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionOverflow(t *testing.T) {
+	s := newSubscription(&SubscribeOptions{BufferSize: 2})
+	for _, p := range []string{"1", "2", "3"} {
+		s.push(&Message{Payload: p})
+	}
+	if s.Dropped() != 1 || (<-s.msgs).Payload != "1" || (<-s.msgs).Payload != "2" {
+		t.Fatal("drop newest", s.Dropped())
+	}
+
+	s = newSubscription(&SubscribeOptions{BufferSize: 2, Overflow: DropOldest})
+	for _, p := range []string{"1", "2", "3"} {
+		s.push(&Message{Payload: p})
+	}
+	if s.Dropped() != 1 || (<-s.msgs).Payload != "2" || (<-s.msgs).Payload != "3" {
+		t.Fatal("drop oldest", s.Dropped())
+	}
+
+	s = newSubscription(&SubscribeOptions{BufferSize: 1, Overflow: Block})
+	s.push(&Message{Payload: "1"})
+	pushed := make(chan struct{})
+	go func() {
+		s.push(&Message{Payload: "2"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push did not block")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-s.msgs
+	<-pushed
+	if s.Dropped() != 0 || (<-s.msgs).Payload != "2" {
+		t.Fatal("block", s.Dropped())
+	}
+}
+
+func TestSubscriptionCloseFromHandler(t *testing.T) {
+	s := newSubscription(nil)
+	var got []string
+	closed := make(chan struct{})
+	go s.handle(func(msg *Message) {
+		got = append(got, msg.Payload)
+		if msg.Payload == "1" {
+			_ = s.Close()
+			close(closed)
+		}
+	})
+	s.push(&Message{Payload: "1"})
+	s.push(&Message{Payload: "2"})
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close from the handler blocked")
+	}
+	if !s.stopped() {
+		t.Fatal("not stopped")
+	}
+	// receive ends on stop, the buffered message is still delivered
+	close(s.msgs)
+	<-s.Done()
+	if len(got) != 2 {
+		t.Fatal(got)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	config := testConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var got []string
+	sub, err := PSubscribe(ctx, config, func(msg *Message) {
+		mu.Lock()
+		got = append(got, msg.Channel+":"+msg.Payload)
+		mu.Unlock()
+	}, nil, "test:pubsub:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Publish(config, "test:pubsub:a", "hello"); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscription not ended by ctx")
+	}
+	if len(got) != 1 || got[0] != "test:pubsub:a:hello" {
+		t.Fatal(got)
+	}
+}
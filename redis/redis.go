@@ -1,13 +1,19 @@
 package redis
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"github.com/yanzongzhen/Logger/logger"
 	"github.com/yanzongzhen/utils/crypto"
 	redis2 "github.com/go-redis/redis"
+	"io/ioutil"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,15 +30,138 @@ var lock *sync.RWMutex
 
 var ErrorNotExist = errors.New("not found")
 
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Config must not be changed once used, its client is cached under the values of the first call.
 type Config struct {
 	Url      string `json:"redis_url"`
 	Password string `json:"password"`
 	DB       int    `json:"redis_db"`
+	// Mode is ModeStandalone (default), ModeSentinel or ModeCluster
+	Mode string `json:"mode"`
+	// MasterName is the master monitored by the sentinels
+	MasterName string `json:"master_name"`
+	// Addrs are the sentinel addresses or the cluster seed nodes, Url is used when empty
+	Addrs []string `json:"addrs"`
+
+	// The fields below are optional, zero keeps the defaults:
+	// 5s dial, read and write timeouts, 3 retries and the go-redis pool of 10 connections per CPU.
+	PoolSize     int           `json:"pool_size"`
+	MinIdleConns int           `json:"min_idle_conns"`
+	IdleTimeout  time.Duration `json:"idle_timeout"`
+	// PoolTimeout is the wait for a free connection when the pool is exhausted
+	PoolTimeout  time.Duration `json:"pool_timeout"`
+	DialTimeout  time.Duration `json:"dial_timeout"`
+	ReadTimeout  time.Duration `json:"read_timeout"`
+	WriteTimeout time.Duration `json:"write_timeout"`
+	// MaxRetries of a failed command, -1 disables retries
+	MaxRetries      int           `json:"max_retries"`
+	MinRetryBackoff time.Duration `json:"min_retry_backoff"`
+	MaxRetryBackoff time.Duration `json:"max_retry_backoff"`
+
+	// TLS enables TLS, the CA, certificate and key files are optional PEM files
+	TLS                   bool   `json:"tls"`
+	TLSServerName         string `json:"tls_server_name"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"`
+	TLSCAFile             string `json:"tls_ca_file"`
+	TLSCertFile           string `json:"tls_cert_file"`
+	TLSKeyFile            string `json:"tls_key_file"`
+	// TLSConfig is used as is instead of the TLS fields when set
+	TLSConfig *tls.Config `json:"-"`
+	// Codec serializes structs, slices and maps, JSONCodec when nil
+	Codec Codec `json:"-"`
+
+	// key is the configKey set by the first getConfigStr
+	key atomic.Value
+}
+
+// configKey is the client cache key of config, a copied Config computes its own
+type configKey struct {
+	config *Config
+	key    string
+}
+
+// clientOptions are the resolved tuning fields of a Config
+type clientOptions struct {
+	poolSize, minIdleConns, maxRetries     int
+	idleTimeout, poolTimeout               time.Duration
+	dialTimeout, readTimeout, writeTimeout time.Duration
+	minRetryBackoff, maxRetryBackoff       time.Duration
+	tlsConfig                              *tls.Config
+}
+
+func orDefault(d time.Duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+func (config *Config) clientOptions() (*clientOptions, error) {
+	o := &clientOptions{
+		poolSize:        config.PoolSize,
+		minIdleConns:    config.MinIdleConns,
+		maxRetries:      config.MaxRetries,
+		idleTimeout:     config.IdleTimeout,
+		poolTimeout:     config.PoolTimeout,
+		dialTimeout:     orDefault(config.DialTimeout, time.Second*5),
+		readTimeout:     orDefault(config.ReadTimeout, time.Second*5),
+		writeTimeout:    orDefault(config.WriteTimeout, time.Second*5),
+		minRetryBackoff: config.MinRetryBackoff,
+		maxRetryBackoff: config.MaxRetryBackoff,
+	}
+	switch o.maxRetries {
+	case 0:
+		o.maxRetries = 3
+	case -1:
+		o.maxRetries = 0
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	o.tlsConfig = tlsConfig
+	return o, nil
+}
+
+func (config *Config) tlsConfig() (*tls.Config, error) {
+	if config.TLSConfig != nil {
+		return config.TLSConfig, nil
+	}
+	if !config.TLS {
+		return nil, nil
+	}
+	c := &tls.Config{
+		ServerName:         config.TLSServerName,
+		InsecureSkipVerify: config.TLSInsecureSkipVerify,
+	}
+	if config.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate in " + config.TLSCAFile)
+		}
+	}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
 }
 
 type redisConn struct {
 	err     error
-	client  *redis2.Client
+	client  redis2.UniversalClient
 	stop    chan int
 	diaLock *sync.Mutex
 	config  *Config
@@ -53,15 +182,11 @@ func (c *redisConn) dial() error {
 	if c.err == nil {
 		return nil
 	}
-	redisClient := redis2.NewClient(&redis2.Options{
-		Addr:         c.config.Url,
-		Password:     c.config.Password,
-		DB:           c.config.DB,
-		DialTimeout:  time.Second * 5,
-		ReadTimeout:  time.Second * 5,
-		WriteTimeout: time.Second * 5,
-		MaxRetries:   3,
-	})
+	redisClient, err := c.config.newClient()
+	if err != nil {
+		c.err = err
+		return err
+	}
 
 	c.err = redisClient.Ping().Err()
 	c.client = redisClient
@@ -104,15 +229,129 @@ func NewRedisConfig(url string, password string, db int) *Config {
 	}
 }
 
+// NewSentinelConfig returns the Config of the master named masterName watched by the sentinels at addrs
+func NewSentinelConfig(masterName string, addrs []string, password string, db int) *Config {
+	return &Config{
+		Mode:       ModeSentinel,
+		MasterName: masterName,
+		Addrs:      addrs,
+		Password:   password,
+		DB:         db,
+	}
+}
+
+// NewClusterConfig returns the Config of the Redis Cluster reachable through the seed nodes addrs
+func NewClusterConfig(addrs []string, password string) *Config {
+	return &Config{
+		Mode:     ModeCluster,
+		Addrs:    addrs,
+		Password: password,
+	}
+}
+
+// addrs returns Addrs, or the comma separated Url when Addrs is empty
+func (config *Config) addrs() []string {
+	if len(config.Addrs) > 0 {
+		return config.Addrs
+	}
+	res := make([]string, 0, 1)
+	for _, addr := range strings.Split(config.Url, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
+
+func (config *Config) newClient() (redis2.UniversalClient, error) {
+	o, err := config.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	switch config.Mode {
+	case "", ModeStandalone:
+		return redis2.NewClient(&redis2.Options{
+			Addr:            config.Url,
+			Password:        config.Password,
+			DB:              config.DB,
+			DialTimeout:     o.dialTimeout,
+			ReadTimeout:     o.readTimeout,
+			WriteTimeout:    o.writeTimeout,
+			MaxRetries:      o.maxRetries,
+			MinRetryBackoff: o.minRetryBackoff,
+			MaxRetryBackoff: o.maxRetryBackoff,
+			PoolSize:        o.poolSize,
+			MinIdleConns:    o.minIdleConns,
+			PoolTimeout:     o.poolTimeout,
+			IdleTimeout:     o.idleTimeout,
+			TLSConfig:       o.tlsConfig,
+		}), nil
+	case ModeSentinel:
+		if config.MasterName == "" {
+			return nil, errors.New("sentinel mode needs a master name")
+		}
+		return redis2.NewFailoverClient(&redis2.FailoverOptions{
+			MasterName:      config.MasterName,
+			SentinelAddrs:   config.addrs(),
+			Password:        config.Password,
+			DB:              config.DB,
+			DialTimeout:     o.dialTimeout,
+			ReadTimeout:     o.readTimeout,
+			WriteTimeout:    o.writeTimeout,
+			MaxRetries:      o.maxRetries,
+			MinRetryBackoff: o.minRetryBackoff,
+			MaxRetryBackoff: o.maxRetryBackoff,
+			PoolSize:        o.poolSize,
+			MinIdleConns:    o.minIdleConns,
+			PoolTimeout:     o.poolTimeout,
+			IdleTimeout:     o.idleTimeout,
+			TLSConfig:       o.tlsConfig,
+		}), nil
+	case ModeCluster:
+		if config.DB != 0 {
+			return nil, errors.New("redis cluster only has db 0")
+		}
+		return redis2.NewClusterClient(&redis2.ClusterOptions{
+			Addrs:           config.addrs(),
+			Password:        config.Password,
+			DialTimeout:     o.dialTimeout,
+			ReadTimeout:     o.readTimeout,
+			WriteTimeout:    o.writeTimeout,
+			MaxRetries:      o.maxRetries,
+			MinRetryBackoff: o.minRetryBackoff,
+			MaxRetryBackoff: o.maxRetryBackoff,
+			PoolSize:        o.poolSize,
+			MinIdleConns:    o.minIdleConns,
+			PoolTimeout:     o.poolTimeout,
+			IdleTimeout:     o.idleTimeout,
+			TLSConfig:       o.tlsConfig,
+		}), nil
+	}
+	return nil, errors.New("unknown redis mode:" + config.Mode)
+}
+
+// getConfigStr returns the client cache key, hashed once per Config
 func (config *Config) getConfigStr() string {
-	return crypto.MD5(config.Url + config.Password + strconv.Itoa(config.DB))
+	if k, ok := config.key.Load().(configKey); ok && k.config == config {
+		return k.key
+	}
+	key := crypto.MD5(config.Url + config.Password + strconv.Itoa(config.DB) +
+		"|" + config.Mode + "|" + config.MasterName + "|" + strings.Join(config.Addrs, ",") +
+		fmt.Sprintf("|%d|%d|%s|%s|%s|%s|%s|%d|%s|%s", config.PoolSize, config.MinIdleConns, config.IdleTimeout,
+			config.PoolTimeout, config.DialTimeout, config.ReadTimeout, config.WriteTimeout,
+			config.MaxRetries, config.MinRetryBackoff, config.MaxRetryBackoff) +
+		fmt.Sprintf("|%t|%s|%t|%s|%s|%s|%p", config.TLS, config.TLSServerName, config.TLSInsecureSkipVerify,
+			config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile, config.TLSConfig))
+	config.key.Store(configKey{config: config, key: key})
+	return key
 }
 
-func initRedisClient(config *Config) *redis2.Client {
+func initRedisClient(config *Config) redis2.UniversalClient {
 	//lock.Lock()
 
+	key := config.getConfigStr()
 	lock.RLock()
-	c, ok := clientMap[config.getConfigStr()]
+	c, ok := clientMap[key]
 	lock.RUnlock()
 	if ok {
 		if c.err == nil {
@@ -120,28 +359,30 @@ func initRedisClient(config *Config) *redis2.Client {
 		} else {
 			c.disConnect()
 			lock.Lock()
-			delete(clientMap, config.getConfigStr())
+			delete(clientMap, key)
 			lock.Unlock()
 			return nil
 		}
 	} else {
+		// dial outside the lock, an unreachable instance must not stall the clients of the others
+		c := newConnection(config)
+		if err := c.dial(); err != nil {
+			c.disConnect()
+			return nil
+		}
 		lock.Lock()
 		defer lock.Unlock()
-		if c, ok := clientMap[config.getConfigStr()]; ok {
-			if c.err == nil {
-				return c.client
+		if old, ok := clientMap[key]; ok {
+			// a concurrent call dialed first
+			c.disConnect()
+			if old.err == nil {
+				return old.client
 			}
 			return nil
-		} else {
-			c := newConnection(config)
-			err := c.dial()
-			if err != nil {
-				return nil
-			}
-			go c.ping()
-			clientMap[config.getConfigStr()] = c
-			return c.client
 		}
+		go c.ping()
+		clientMap[key] = c
+		return c.client
 	}
 }
 
@@ -150,7 +391,11 @@ func Set(config *Config, key string, value interface{}, expireTime time.Duration
 	if client == nil {
 		return errors.New("connect redis error")
 	}
-	return client.Set(key, value, expireTime).Err()
+	v, err := encodeValue(config.codec(), value)
+	if err != nil {
+		return err
+	}
+	return client.Set(key, v, expireTime).Err()
 }
 
 func HSet(config *Config, key string, field string, value interface{}) error {
@@ -158,7 +403,11 @@ func HSet(config *Config, key string, field string, value interface{}) error {
 	if client == nil {
 		return errors.New("connect redis error")
 	}
-	return client.HSet(key, field, value).Err()
+	v, err := encodeValue(config.codec(), value)
+	if err != nil {
+		return err
+	}
+	return client.HSet(key, field, v).Err()
 }
 
 func HMSet(config *Config, key string, fields map[string]interface{}) error {
@@ -166,7 +415,15 @@ func HMSet(config *Config, key string, fields map[string]interface{}) error {
 	if client == nil {
 		return errors.New("connect redis error")
 	}
-	return client.HMSet(key, fields).Err()
+	values := make(map[string]interface{}, len(fields))
+	for k, value := range fields {
+		v, err := encodeValue(config.codec(), value)
+		if err != nil {
+			return err
+		}
+		values[k] = v
+	}
+	return client.HMSet(key, values).Err()
 }
 
 func HSetNX(config *Config, key string, field string, value interface{}) error {
@@ -174,7 +431,11 @@ func HSetNX(config *Config, key string, field string, value interface{}) error {
 	if client == nil {
 		return errors.New("connect redis error")
 	}
-	return client.HSetNX(key, field, value).Err()
+	v, err := encodeValue(config.codec(), value)
+	if err != nil {
+		return err
+	}
+	return client.HSetNX(key, field, v).Err()
 }
 
 func SetNX(config *Config, key string, value interface{}, expireTime time.Duration) (bool, error) {
@@ -182,7 +443,11 @@ func SetNX(config *Config, key string, value interface{}, expireTime time.Durati
 	if client == nil {
 		return false, errors.New("connect redis error")
 	}
-	res := client.SetNX(key, value, expireTime)
+	v, err := encodeValue(config.codec(), value)
+	if err != nil {
+		return false, err
+	}
+	res := client.SetNX(key, v, expireTime)
 	isOk, err := res.Result()
 	if err != nil {
 		logger.Error(err)
@@ -200,7 +465,32 @@ func Delete(config *Config, key ...string) error {
 	if client == nil {
 		return errors.New("connect redis error")
 	}
-	return client.Del(key...).Err()
+	_, err := countKeys(client, config.Mode == ModeCluster, redis2.Cmdable.Del, key)
+	return err
+}
+
+// countKeys runs the multi key cmd, e.g. DEL or EXISTS, and returns the sum of its replies.
+// In cluster mode the keys may hash to different slots, which fails with CROSSSLOT,
+// so each key gets its own command in a pipeline that routes it to the node of its slot.
+func countKeys(client redis2.Cmdable, cluster bool, cmd func(c redis2.Cmdable, keys ...string) *redis2.IntCmd, keys []string) (int64, error) {
+	if !cluster || len(keys) < 2 {
+		return cmd(client, keys...).Result()
+	}
+	res := make([]*redis2.IntCmd, len(keys))
+	_, err := client.Pipelined(func(p redis2.Pipeliner) error {
+		for i, key := range keys {
+			res[i] = cmd(p, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, r := range res {
+		n += r.Val()
+	}
+	return n, nil
 }
 
 func Get(config *Config, key string, value interface{}) error {
@@ -215,7 +505,7 @@ func Get(config *Config, key string, value interface{}) error {
 	}
 	res := client.Get(key)
 	if err := res.Err(); err == nil {
-		return res.Scan(value)
+		return decodeValue(config.codec(), res.Val(), value)
 	} else {
 		if err == redis2.Nil {
 			return ErrorNotExist
@@ -236,7 +526,7 @@ func HGet(config *Config, key string, field string, value interface{}) error {
 	}
 	res := client.HGet(key, field)
 	if err := res.Err(); err == nil {
-		return res.Scan(value)
+		return decodeValue(config.codec(), res.Val(), value)
 	} else {
 		if err == redis2.Nil {
 			return ErrorNotExist
@@ -245,6 +535,23 @@ func HGet(config *Config, key string, field string, value interface{}) error {
 	}
 }
 
+// HGetAll reads the hash key into value, a pointer to a struct with fields named by
+// the redis tag, e.g. `redis:"name"`, or to a map with string keys
+func HGetAll(config *Config, key string, value interface{}) error {
+	client := initRedisClient(config)
+	if client == nil {
+		return errors.New("connect redis error")
+	}
+	res, err := client.HGetAll(key).Result()
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		return ErrorNotExist
+	}
+	return decodeHash(config.codec(), res, value)
+}
+
 func IncrNum(config *Config, key string) (int64, error) {
 	client := initRedisClient(config)
 	if client == nil {
@@ -315,12 +622,33 @@ func DecrNum(config *Config, key string) (int64, error) {
 
 type TravelKeysFunc func(key []string) error
 
+// TravelDB scans every key of the db and calls tFunc with each batch of about count keys.
+// In cluster mode every master is scanned, tFunc is never called concurrently.
 func TravelDB(config *Config, tFunc TravelKeysFunc, count int64) error {
 	client := initRedisClient(config)
 
 	if client == nil {
 		return errors.New("connect redis error")
 	}
+	if cluster, ok := client.(*redis2.ClusterClient); ok {
+		// masters are scanned in parallel, calls to tFunc are serialized and the first error stops every scan
+		mu := &sync.Mutex{}
+		var failed error
+		return cluster.ForEachMaster(func(master *redis2.Client) error {
+			return scanKeys(master, func(keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if failed == nil {
+					failed = tFunc(keys)
+				}
+				return failed
+			}, count)
+		})
+	}
+	return scanKeys(client, tFunc, count)
+}
+
+func scanKeys(client redis2.Cmdable, tFunc TravelKeysFunc, count int64) error {
 	var cursor uint64 = 0
 	for {
 		keysScan := client.Scan(cursor, "", count)
@@ -380,9 +708,8 @@ func Exists(config *Config, key ...string) (bool, error) {
 		return false, errors.New("connect redis error")
 	}
 
-	res := client.Exists(key...)
-	if err := res.Err(); err == nil {
-		r, _ := res.Result()
+	r, err := countKeys(client, config.Mode == ModeCluster, redis2.Cmdable.Exists, key)
+	if err == nil {
 		return r == 1, nil
 	} else {
 		if err == redis2.Nil {
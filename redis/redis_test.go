@@ -1,8 +1,10 @@
 package redis
 
 import (
+	redis2 "github.com/go-redis/redis"
 	"github.com/yanzongzhen/Logger/logger"
 	"testing"
+	"time"
 )
 
 func TestGet(t *testing.T) {
@@ -33,3 +35,130 @@ func TestGet(t *testing.T) {
 
 	logger.Error(err)
 }
+
+func TestConfigModes(t *testing.T) {
+	standalone := NewRedisConfig("127.0.0.1:6379", "pw", 1)
+	sentinel := NewSentinelConfig("mymaster", []string{"10.0.0.1:26379", "10.0.0.2:26379"}, "pw", 1)
+	cluster := NewClusterConfig([]string{"10.0.0.1:7000"}, "pw")
+	seen := make(map[string]bool)
+	for _, c := range []*Config{standalone, sentinel, cluster} {
+		if seen[c.getConfigStr()] {
+			t.Fatal("config collision", c)
+		}
+		seen[c.getConfigStr()] = true
+	}
+
+	if addrs := (&Config{Url: "10.0.0.1:7000, 10.0.0.2:7000"}).addrs(); len(addrs) != 2 || addrs[1] != "10.0.0.2:7000" {
+		t.Fatal(addrs)
+	}
+
+	client, err := cluster.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+	if _, ok := client.(*redis2.ClusterClient); !ok {
+		t.Fatalf("%T", client)
+	}
+	if _, err := (&Config{Mode: ModeSentinel}).newClient(); err == nil {
+		t.Fatal("expected missing master name error")
+	}
+	if _, err := (&Config{Mode: ModeCluster, DB: 2}).newClient(); err == nil {
+		t.Fatal("expected cluster db error")
+	}
+	if _, err := (&Config{Mode: "ring"}).newClient(); err == nil {
+		t.Fatal("expected unknown mode error")
+	}
+}
+
+func TestConfigTuning(t *testing.T) {
+	api := NewRedisConfig("127.0.0.1:6379", "pw", 1)
+	batch := NewRedisConfig("127.0.0.1:6379", "pw", 1)
+	batch.ReadTimeout = time.Minute
+	batch.PoolSize = 50
+	if api.getConfigStr() == batch.getConfigStr() {
+		t.Fatal("differently tuned configs collide")
+	}
+	tlsOn := NewRedisConfig("127.0.0.1:6379", "pw", 1)
+	tlsOn.TLS = true
+	if api.getConfigStr() == tlsOn.getConfigStr() {
+		t.Fatal("tls config collides")
+	}
+
+	o, err := api.clientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.readTimeout != 5*time.Second || o.maxRetries != 3 || o.tlsConfig != nil {
+		t.Fatal(o)
+	}
+	batch.MaxRetries = -1
+	if o, _ = batch.clientOptions(); o.readTimeout != time.Minute || o.maxRetries != 0 || o.poolSize != 50 {
+		t.Fatal(o)
+	}
+	tlsOn.TLSServerName = "redis.local"
+	if o, _ = tlsOn.clientOptions(); o.tlsConfig == nil || o.tlsConfig.ServerName != "redis.local" {
+		t.Fatal(o)
+	}
+	tlsOn.TLSCAFile = "/nonexistent/ca.pem"
+	if _, err := tlsOn.clientOptions(); err == nil {
+		t.Fatal("expected missing ca file error")
+	}
+
+	// the key is hashed once, a copy hashes its own values
+	key := api.getConfigStr()
+	api.PoolSize = 7
+	if api.getConfigStr() != key {
+		t.Fatal("key recomputed")
+	}
+	copied := *api
+	if copied.getConfigStr() == key {
+		t.Fatal("copy kept the key of its source")
+	}
+}
+
+// keyCounter answers DEL and EXISTS with the number of given keys and records the calls,
+// the embedded interface is nil, other commands panic
+type keyCounter struct {
+	redis2.Pipeliner
+	calls     [][]string
+	pipelined int
+}
+
+func (c *keyCounter) Del(keys ...string) *redis2.IntCmd {
+	c.calls = append(c.calls, keys)
+	return redis2.NewIntResult(int64(len(keys)), nil)
+}
+
+func (c *keyCounter) Exists(keys ...string) *redis2.IntCmd {
+	return c.Del(keys...)
+}
+
+func (c *keyCounter) Pipelined(fn func(redis2.Pipeliner) error) ([]redis2.Cmder, error) {
+	c.pipelined++
+	return nil, fn(c)
+}
+
+func TestCountKeys(t *testing.T) {
+	c := &keyCounter{}
+	if n, err := countKeys(c, false, redis2.Cmdable.Del, []string{"a", "b", "c"}); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if c.pipelined != 0 || len(c.calls) != 1 || len(c.calls[0]) != 3 {
+		t.Fatal(c.calls)
+	}
+
+	// cluster keys may live in different slots, one command per key
+	c = &keyCounter{}
+	if n, err := countKeys(c, true, redis2.Cmdable.Exists, []string{"a", "b", "c"}); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if c.pipelined != 1 || len(c.calls) != 3 {
+		t.Fatal(c.calls)
+	}
+	for _, keys := range c.calls {
+		if len(keys) != 1 {
+			t.Fatal(c.calls)
+		}
+	}
+}
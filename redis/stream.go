@@ -0,0 +1,318 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	redis2 "github.com/go-redis/redis"
+	"github.com/yanzongzhen/Logger/logger"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// XAdd appends values to stream and returns the id of the entry.
+// With maxLen > 0 the stream is trimmed to about maxLen entries (MAXLEN ~), which redis
+// does in whole nodes and so much cheaper than an exact trim.
+func XAdd(config *Config, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	client := initRedisClient(config)
+	if client == nil {
+		return "", errors.New("connect redis error")
+	}
+	return client.XAdd(&redis2.XAddArgs{Stream: stream, MaxLenApprox: maxLen, Values: values}).Result()
+}
+
+// StreamMessage is an entry delivered to a consumer group
+type StreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+	// Deliveries counts the deliveries of the entry including this one
+	Deliveries int64
+}
+
+// StreamHandler processes a message, the message is acknowledged when it returns nil.
+// A failed message stays pending and is delivered again once it is claimed.
+type StreamHandler func(msg *StreamMessage) error
+
+// ConsumerOptions tunes a Consumer, zero values keep the defaults
+type ConsumerOptions struct {
+	// Consumer names this consumer in the group, hostname-pid by default. It must be unique within the group.
+	Consumer string
+	// Workers is the number of concurrent handlers, 1 by default
+	Workers int
+	// Count is the number of entries fetched at once, 10 by default
+	Count int64
+	// Block is the wait of a read on an empty stream, 5s by default. Run returns within Block after ctx is done.
+	Block time.Duration
+	// StartID is where a new group starts reading, "$" (new entries only) by default, "0" reads the whole stream
+	StartID string
+	// ClaimIdle is the idle time after which a pending entry of any consumer is claimed, 1m by default, -1 disables claiming
+	ClaimIdle time.Duration
+	// ClaimInterval is the period of the pending entries scan, ClaimIdle/2 by default
+	ClaimInterval time.Duration
+	// MaxDeliveries moves an entry delivered that many times to the DeadLetter stream instead of claiming it again, 0 never does
+	MaxDeliveries int64
+	// DeadLetter is the stream of the given up entries, <stream>:dead by default
+	DeadLetter string
+}
+
+// Consumer runs the workers of a consumer group on a stream.
+//
+//	c := redis.NewConsumer(config, "orders", "billing", handle, &redis.ConsumerOptions{Workers: 4, MaxDeliveries: 5})
+//	err := c.Run(ctx)
+type Consumer struct {
+	config  *Config
+	stream  string
+	group   string
+	handler StreamHandler
+	opts    ConsumerOptions
+	jobs    chan *StreamMessage
+}
+
+func NewConsumer(config *Config, stream string, group string, handler StreamHandler, opts *ConsumerOptions) *Consumer {
+	c := &Consumer{config: config, stream: stream, group: group, handler: handler}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Consumer == "" {
+		host, _ := os.Hostname()
+		c.opts.Consumer = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	if c.opts.Workers <= 0 {
+		c.opts.Workers = 1
+	}
+	if c.opts.Count <= 0 {
+		c.opts.Count = 10
+	}
+	if c.opts.Block <= 0 {
+		c.opts.Block = 5 * time.Second
+	}
+	if c.opts.StartID == "" {
+		c.opts.StartID = "$"
+	}
+	if c.opts.ClaimIdle == 0 {
+		c.opts.ClaimIdle = time.Minute
+	}
+	if c.opts.ClaimInterval <= 0 {
+		c.opts.ClaimInterval = c.opts.ClaimIdle / 2
+	}
+	if c.opts.DeadLetter == "" {
+		c.opts.DeadLetter = stream + ":dead"
+	}
+	return c
+}
+
+// Run creates the group when missing and consumes until ctx is done.
+// It then stops reading and waits for the workers to finish the entries already read.
+func (c *Consumer) Run(ctx context.Context) error {
+	if c.handler == nil {
+		return errors.New("handler is nil")
+	}
+	client := initRedisClient(c.config)
+	if client == nil {
+		return errors.New("connect redis error")
+	}
+	if err := c.createGroup(client); err != nil {
+		return err
+	}
+	c.jobs = make(chan *StreamMessage)
+	var workers sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for msg := range c.jobs {
+				c.process(client, msg)
+			}
+		}()
+	}
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		c.read(ctx, client)
+	}()
+	if c.opts.ClaimIdle > 0 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			c.claim(ctx, client)
+		}()
+	}
+	readers.Wait()
+	close(c.jobs)
+	workers.Wait()
+	return nil
+}
+
+func (c *Consumer) createGroup(client redis2.UniversalClient) error {
+	err := client.XGroupCreateMkStream(c.stream, c.group, c.opts.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// sleep waits d, false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (c *Consumer) read(ctx context.Context, client redis2.UniversalClient) {
+	for ctx.Err() == nil {
+		streams, err := client.XReadGroup(&redis2.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.opts.Consumer,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.opts.Count,
+			Block:    c.opts.Block,
+		}).Result()
+		if err == redis2.Nil {
+			continue
+		}
+		if err != nil {
+			logger.Error(err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// the stream or the group was deleted meanwhile
+				if err := c.createGroup(client); err != nil {
+					logger.Error(err)
+				}
+			}
+			sleep(ctx, time.Second)
+			continue
+		}
+		for _, s := range streams {
+			for _, m := range s.Messages {
+				// entries read are delivered to this consumer, hand them over even when stopping
+				c.jobs <- &StreamMessage{Stream: s.Stream, ID: m.ID, Values: m.Values, Deliveries: 1}
+			}
+		}
+	}
+}
+
+// claim periodically takes over the entries left pending by failed handlers or dead consumers
+func (c *Consumer) claim(ctx context.Context, client redis2.UniversalClient) {
+	for sleep(ctx, c.opts.ClaimInterval) {
+		if err := c.claimPending(client); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+func (c *Consumer) claimPending(client redis2.UniversalClient) error {
+	start := "-"
+	for {
+		pending, err := client.XPendingExt(&redis2.XPendingExtArgs{
+			Stream: c.stream,
+			Group:  c.group,
+			Start:  start,
+			End:    "+",
+			Count:  c.opts.Count,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(pending))
+		deliveries := make(map[string]int64, len(pending))
+		for _, p := range pending {
+			if p.Idle < c.opts.ClaimIdle {
+				continue
+			}
+			if c.opts.MaxDeliveries > 0 && p.RetryCount >= c.opts.MaxDeliveries {
+				if err := c.deadLetter(client, p.Id, p.RetryCount); err != nil {
+					logger.Error(err)
+				}
+				continue
+			}
+			ids = append(ids, p.Id)
+			deliveries[p.Id] = p.RetryCount + 1
+		}
+		if len(ids) > 0 {
+			// MinIdle makes the claim fail for the entries another consumer claimed meanwhile
+			msgs, err := client.XClaim(&redis2.XClaimArgs{
+				Stream:   c.stream,
+				Group:    c.group,
+				Consumer: c.opts.Consumer,
+				MinIdle:  c.opts.ClaimIdle,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return err
+			}
+			for _, m := range msgs {
+				c.jobs <- &StreamMessage{Stream: c.stream, ID: m.ID, Values: m.Values, Deliveries: deliveries[m.ID]}
+			}
+		}
+		if int64(len(pending)) < c.opts.Count {
+			return nil
+		}
+		start = nextID(pending[len(pending)-1].Id)
+	}
+}
+
+// nextID returns the smallest stream id after id
+func nextID(id string) string {
+	i := strings.IndexByte(id, '-')
+	if i == -1 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10)
+}
+
+// deadLetter copies entry id to the dead letter stream and acknowledges it
+func (c *Consumer) deadLetter(client redis2.UniversalClient, id string, deliveries int64) error {
+	msgs, err := client.XRangeN(c.stream, id, id, 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 1 {
+		values := make(map[string]interface{}, len(msgs[0].Values)+3)
+		for k, v := range msgs[0].Values {
+			values[k] = v
+		}
+		values["dead_stream"] = c.stream
+		values["dead_id"] = id
+		values["dead_deliveries"] = deliveries
+		if err := client.XAdd(&redis2.XAddArgs{Stream: c.opts.DeadLetter, Values: values}).Err(); err != nil {
+			return err
+		}
+		logger.Error(fmt.Sprintf("stream %s entry %s moved to %s after %d deliveries", c.stream, id, c.opts.DeadLetter, deliveries))
+	}
+	// a trimmed entry has nothing left to move
+	return client.XAck(c.stream, c.group, id).Err()
+}
+
+func (c *Consumer) process(client redis2.UniversalClient, msg *StreamMessage) {
+	if err := c.handle(msg); err != nil {
+		logger.Error(fmt.Sprintf("stream %s entry %s: %v", msg.Stream, msg.ID, err))
+		return
+	}
+	if err := client.XAck(msg.Stream, c.group, msg.ID).Err(); err != nil {
+		// the entry is claimed and handled again
+		logger.Error(err)
+	}
+}
+
+// handle turns a panic of the handler into a failure so that the worker survives
+func (c *Consumer) handle(msg *StreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return c.handler(msg)
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumerOptions(t *testing.T) {
+	c := NewConsumer(&Config{}, "orders", "billing", nil, nil)
+	if c.opts.Consumer == "" || c.opts.Workers != 1 || c.opts.ClaimInterval != 30*time.Second || c.opts.DeadLetter != "orders:dead" {
+		t.Fatal(c.opts)
+	}
+	if err := c.Run(context.Background()); err == nil {
+		t.Fatal("expected nil handler error")
+	}
+	if c = NewConsumer(&Config{}, "orders", "billing", nil, &ConsumerOptions{ClaimIdle: -1}); c.opts.ClaimIdle != -1 {
+		t.Fatal(c.opts.ClaimIdle)
+	}
+	for id, want := range map[string]string{"1526984818136-0": "1526984818136-1", "7-41": "7-42", "x": "x"} {
+		if got := nextID(id); got != want {
+			t.Fatal(id, got)
+		}
+	}
+	c.handler = func(msg *StreamMessage) error { panic("boom") }
+	if err := c.handle(&StreamMessage{}); err == nil {
+		t.Fatal("panic not recovered")
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	config := testConfig(t)
+	stream := "test:stream"
+	_ = Delete(config, stream, stream+":dead")
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	handled := make(map[string]int64)
+	c := NewConsumer(config, stream, "test", func(msg *StreamMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.Values["n"].(string)] = msg.Deliveries
+		if msg.Values["n"] == "bad" {
+			return errors.New("bad entry")
+		}
+		return nil
+	}, &ConsumerOptions{Workers: 2, Block: 100 * time.Millisecond, StartID: "0", ClaimIdle: 50 * time.Millisecond, MaxDeliveries: 2})
+	for _, n := range []string{"1", "2", "bad"} {
+		if _, err := XAdd(config, stream, map[string]interface{}{"n": n}, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		client := initRedisClient(config)
+		if n, _ := client.XLen(stream + ":dead").Result(); n == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["1"] != 1 || handled["2"] != 1 || handled["bad"] != 2 {
+		t.Fatal(handled)
+	}
+	client := initRedisClient(config)
+	if p, err := client.XPending(stream, "test").Result(); err != nil || p.Count != 0 {
+		t.Fatal(p, err)
+	}
+	_ = Delete(config, stream, stream+":dead")
+}